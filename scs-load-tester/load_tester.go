@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -20,19 +22,26 @@ var (
 	flagFlows       = flag.Int("flows", 200000, "Total number of checkout flows to run")
 	flagConcurrency = flag.Int("concurrency", 100, "Number of concurrent workers")
 	flagDebug       = flag.Bool("debug", false, "Enable debug logging")
+	flagTokenize    = flag.Bool("tokenize", false, "Exchange the card number for a CCA token once and check out with card_token")
+	flagPoll        = flag.Bool("poll", false, "With async checkout (202), poll the order status URL until the order is queued, declined or failed")
+	flagTrace       = flag.Bool("trace", false, "Send a W3C traceparent header so every request of a flow shares one trace ID")
+	flagProduct     = flag.Int("product", 1, "Product to check out, from the catalog every product instance loads (PRODUCT_CATALOG); 0 creates one, which only the instance that created it knows")
 )
 
+const testCardNumber = "4111-1111-1111-1111"
+
 // ===== Counters =====
 
 var (
 	totalFlows    int64
 	authCount     int64
+	acceptedCount int64
 	declinedCount int64
 	badReqCount   int64
 	otherErrors   int64
 
 	// NEW: status code counter map
-	statusMu      sync.Mutex
+	statusMu       sync.Mutex
 	statusCountMap = map[int]int64{}
 
 	// NEW: capture sample client errors
@@ -62,6 +71,11 @@ type createCartResp struct {
 	ShoppingCartID int `json:"shopping_cart_id"`
 }
 
+type orderStatusResp struct {
+	Status    string `json:"status"`
+	StatusURL string `json:"status_url"`
+}
+
 func newHTTPClient() *http.Client {
 	transport := &http.Transport{
 		MaxIdleConns:        1000,
@@ -81,6 +95,34 @@ func newHTTPClient() *http.Client {
 	}
 }
 
+// traceTransport sets a traceparent header on every request: the flow's
+// trace ID with a fresh parent ID per request, sampled.
+type traceTransport struct {
+	base    http.RoundTripper
+	traceID string
+}
+
+func (t traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("traceparent", "00-"+t.traceID+"-"+randomHex(8)+"-01")
+	return t.base.RoundTrip(req)
+}
+
+// withTrace returns a client that sends every request in a new trace, and
+// the trace ID.
+func withTrace(client *http.Client) (*http.Client, string) {
+	traceID := randomHex(16)
+	traced := *client
+	traced.Transport = traceTransport{base: client.Transport, traceID: traceID}
+	return &traced, traceID
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
 func doJSONRequest(client *http.Client, method, url string, body any) (*http.Response, []byte, error) {
 	var buf io.Reader
 	if body != nil {
@@ -106,9 +148,117 @@ func doJSONRequest(client *http.Client, method, url string, body any) (*http.Res
 	return resp, respBody, nil
 }
 
-func runFlow(client *http.Client, baseURL string, debug bool) {
+// tokenizeCard exchanges the test card number for a CCA card token.
+func tokenizeCard(client *http.Client, baseURL string) (string, error) {
+	resp, body, err := doJSONRequest(client, "POST", baseURL+"/credit-card-authorizer/tokenize", map[string]any{
+		"credit_card_number": testCardNumber,
+	})
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("tokenize returned %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tok struct {
+		CardToken string `json:"card_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.CardToken == "" {
+		return "", fmt.Errorf("invalid tokenize response: %s", string(body))
+	}
+	return tok.CardToken, nil
+}
+
+// createProduct creates the priced product every flow adds to its cart
+// (-product 0). The ALB may route to the bad product service, so 503s are
+// retried a few times.
+func createProduct(client *http.Client, baseURL string) (int, error) {
+	var lastErr error
+	for attempt := 0; attempt < 5; attempt++ {
+		resp, body, err := doJSONRequest(client, "POST", baseURL+"/product", map[string]any{
+			"sku":           "LOADTEST1",
+			"manufacturer":  "Load Tester",
+			"category_id":   1,
+			"weight":        100,
+			"some_other_id": 1,
+			"price":         1999,
+			"currency":      "USD",
+		})
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.StatusCode != http.StatusCreated {
+			lastErr = fmt.Errorf("create product returned %d: %s", resp.StatusCode, string(body))
+			continue
+		}
+
+		var product struct {
+			ProductID int `json:"product_id"`
+		}
+		if err := json.Unmarshal(body, &product); err != nil || product.ProductID == 0 {
+			return 0, fmt.Errorf("invalid create product response: %s", string(body))
+		}
+		return product.ProductID, nil
+	}
+	return 0, lastErr
+}
+
+// checkProduct makes sure productID can be looked up through the ALB. The
+// bad product service fails half its requests, so 503s are retried.
+func checkProduct(client *http.Client, baseURL string, productID int) error {
+	var lastErr error
+	for attempt := 0; attempt < 5; attempt++ {
+		resp, body, err := doJSONRequest(client, "GET", fmt.Sprintf("%s/products/%d", baseURL, productID), nil)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return nil
+		case http.StatusNotFound:
+			return fmt.Errorf("product %d is not in the product catalog; start the product services with PRODUCT_CATALOG or pass -product 0", productID)
+		}
+		lastErr = fmt.Errorf("get product returned %d: %s", resp.StatusCode, string(body))
+	}
+	return lastErr
+}
+
+// pollOrder polls an order status URL until the order leaves pending or
+// authorized, and returns the final status.
+func pollOrder(client *http.Client, url string) (string, error) {
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		resp, body, err := doJSONRequest(client, "GET", url, nil)
+		if err != nil {
+			return "", err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("order status returned %d: %s", resp.StatusCode, string(body))
+		}
+		var order orderStatusResp
+		if err := json.Unmarshal(body, &order); err != nil {
+			return "", err
+		}
+		if order.Status != "pending" && order.Status != "authorized" {
+			return order.Status, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return "", fmt.Errorf("order %s still in progress after 30s", url)
+}
+
+func runFlow(client *http.Client, baseURL string, productID int, payment map[string]any, poll, trace, debug bool) {
 	atomic.AddInt64(&totalFlows, 1)
 
+	// traceID stays empty without -trace; debug output includes it so a
+	// failed flow can be looked up in the tracing backend
+	var traceID string
+	if trace {
+		client, traceID = withTrace(client)
+	}
+
 	// 1. create cart
 	resp, body, err := doJSONRequest(client, "POST", baseURL+"/shopping-cart", map[string]any{
 		"customer_id": 1,
@@ -123,7 +273,7 @@ func runFlow(client *http.Client, baseURL string, debug bool) {
 		recordStatus(resp.StatusCode)
 		atomic.AddInt64(&otherErrors, 1)
 		if debug {
-			fmt.Printf("[create-cart] %d %s\n", resp.StatusCode, string(body))
+			fmt.Printf("[create-cart] %d %s trace=%s\n", resp.StatusCode, string(body), traceID)
 		}
 		return
 	}
@@ -137,7 +287,7 @@ func runFlow(client *http.Client, baseURL string, debug bool) {
 	// 2. add item
 	addURL := fmt.Sprintf("%s/shopping-carts/%d/addItem", baseURL, cart.ShoppingCartID)
 	resp, body, err = doJSONRequest(client, "POST", addURL, map[string]any{
-		"product_id": 1,
+		"product_id": productID,
 		"quantity":   1,
 	})
 	if err != nil {
@@ -153,9 +303,7 @@ func runFlow(client *http.Client, baseURL string, debug bool) {
 
 	// 3. checkout
 	ckURL := fmt.Sprintf("%s/shopping-carts/%d/checkout", baseURL, cart.ShoppingCartID)
-	resp, body, err = doJSONRequest(client, "POST", ckURL, map[string]any{
-		"credit_card_number": "1234-5678-9012-3456",
-	})
+	resp, body, err = doJSONRequest(client, "POST", ckURL, payment)
 	if err != nil {
 		recordClientErr(err)
 		atomic.AddInt64(&otherErrors, 1)
@@ -165,6 +313,33 @@ func runFlow(client *http.Client, baseURL string, debug bool) {
 	switch resp.StatusCode {
 	case 200:
 		atomic.AddInt64(&authCount, 1)
+	case 202:
+		atomic.AddInt64(&acceptedCount, 1)
+		if !poll {
+			return
+		}
+		var accepted orderStatusResp
+		if err := json.Unmarshal(body, &accepted); err != nil || accepted.StatusURL == "" {
+			atomic.AddInt64(&otherErrors, 1)
+			return
+		}
+		status, err := pollOrder(client, baseURL+accepted.StatusURL)
+		if err != nil {
+			recordClientErr(err)
+			atomic.AddInt64(&otherErrors, 1)
+			return
+		}
+		switch status {
+		case "queued":
+			atomic.AddInt64(&authCount, 1)
+		case "declined":
+			atomic.AddInt64(&declinedCount, 1)
+		default:
+			atomic.AddInt64(&otherErrors, 1)
+			if debug {
+				fmt.Printf("[order] %s %s trace=%s\n", accepted.StatusURL, status, traceID)
+			}
+		}
 	case 402:
 		atomic.AddInt64(&declinedCount, 1)
 	case 400:
@@ -173,7 +348,7 @@ func runFlow(client *http.Client, baseURL string, debug bool) {
 		recordStatus(resp.StatusCode)
 		atomic.AddInt64(&otherErrors, 1)
 		if debug {
-			fmt.Printf("[checkout] %d %s\n", resp.StatusCode, string(body))
+			fmt.Printf("[checkout] %d %s trace=%s\n", resp.StatusCode, string(body), traceID)
 		}
 	}
 }
@@ -182,7 +357,7 @@ func main() {
 	flag.Parse()
 
 	if *flagALB == "" {
-		fmt.Println("Usage: go run load_tester.go -alb <ALB> [-flows 200000] [-concurrency 100] [-debug]")
+		fmt.Println("Usage: go run load_tester.go -alb <ALB> [-flows 200000] [-concurrency 100] [-product 1] [-tokenize] [-poll] [-trace] [-debug]")
 		os.Exit(1)
 	}
 
@@ -198,6 +373,36 @@ func main() {
 	fmt.Println("Debug:", debug)
 
 	client := newHTTPClient()
+
+	// A product created through the ALB lands on one product instance, and
+	// lookups routed to the others would 404, so use a catalog product
+	productID := *flagProduct
+	if productID > 0 {
+		if err := checkProduct(client, baseURL, productID); err != nil {
+			fmt.Println("Product check failed:", err)
+			os.Exit(1)
+		}
+	} else {
+		var err error
+		productID, err = createProduct(client, baseURL)
+		if err != nil {
+			fmt.Println("Create product failed:", err)
+			os.Exit(1)
+		}
+	}
+	fmt.Println("Using product:", productID)
+
+	payment := map[string]any{"credit_card_number": testCardNumber}
+	if *flagTokenize {
+		token, err := tokenizeCard(client, baseURL)
+		if err != nil {
+			fmt.Println("Tokenize failed:", err)
+			os.Exit(1)
+		}
+		payment = map[string]any{"card_token": token}
+		fmt.Println("Using card token:", token)
+	}
+
 	start := time.Now()
 
 	taskCh := make(chan struct{})
@@ -209,7 +414,7 @@ func main() {
 		go func() {
 			defer wg.Done()
 			for range taskCh {
-				runFlow(client, baseURL, debug)
+				runFlow(client, baseURL, productID, payment, *flagPoll, *flagTrace, debug)
 			}
 		}()
 	}
@@ -230,6 +435,7 @@ func main() {
 	fmt.Printf("Total flows requested: %d\n", total)
 	fmt.Printf("Total flows finished : %d\n", totalFlows)
 	fmt.Printf("200 Authorized     : %d\n", authCount)
+	fmt.Printf("202 Accepted       : %d\n", acceptedCount)
 	fmt.Printf("402 Declined       : %d\n", declinedCount)
 	fmt.Printf("400 Bad Request    : %d\n", badReqCount)
 	fmt.Printf("Other errors       : %d\n", otherErrors)
@@ -260,4 +466,4 @@ func main() {
 		}
 		errMu.Unlock()
 	}
-}
\ No newline at end of file
+}
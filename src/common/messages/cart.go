@@ -0,0 +1,20 @@
+package messages
+
+import "time"
+
+// CartAbandonedEvent is the event type of CartAbandoned.
+const CartAbandonedEvent = "cart.abandoned"
+
+// CartAbandoned is published to the "carts.abandoned" queue when an idle
+// cart that still holds items is expired. Only shopping-cart-service
+// publishes it.
+type CartAbandoned struct {
+	Event          string      `json:"event"`
+	CartID         int         `json:"cart_id"`
+	CustomerID     int         `json:"customer_id"`
+	Items          []OrderItem `json:"items"`
+	CouponCode     string      `json:"coupon_code,omitempty"`
+	CreatedAt      time.Time   `json:"created_at"`
+	LastActivityAt time.Time   `json:"last_activity_at"`
+	AbandonedAt    time.Time   `json:"abandoned_at"`
+}
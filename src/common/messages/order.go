@@ -0,0 +1,204 @@
+// Package messages defines the message contracts exchanged over RabbitMQ:
+// the order message shopping-cart-service (producer) publishes to
+// warehouse-consumer (consumer), the order status events flowing back,
+// and the abandoned-cart event. Both services build against this one
+// definition; any change to the order contract must bump SchemaVersion.
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// SchemaVersion is the order message schema version produced by this build.
+//
+// Version history:
+//   - 1: order_id, cart_id, items (product_id, quantity)
+//   - 2: adds customer_id, authorization_id, correlation_id, created_at and
+//     a product snapshot (sku, weight) on each item
+//   - 3: adds the order amounts (currency, subtotal, discount, tax, total)
+//     and the promotion_code applied at checkout
+//   - 4: adds shipping and shipping_method; total includes shipping
+const SchemaVersion = 4
+
+// MinSchemaVersion is the oldest schema version Decode still accepts.
+const MinSchemaVersion = 1
+
+// SchemaVersionHeader is the AMQP header carrying the schema version.
+const SchemaVersionHeader = "schema-version"
+
+// ErrUnsupportedVersion is returned by Decode for a schema version this
+// build does not understand.
+var ErrUnsupportedVersion = errors.New("unsupported order message schema version")
+
+// OrderItem is one line of an order.
+type OrderItem struct {
+	ProductID int `json:"product_id"`
+	Quantity  int `json:"quantity"`
+
+	// Product snapshot taken at checkout (v2+). Left empty when the
+	// product service could not be reached.
+	SKU    string `json:"sku,omitempty"`
+	Weight int    `json:"weight,omitempty"`
+}
+
+// OrderMessage is the payload published to the "orders" queue at checkout.
+// Fields added after version 1 are zero when decoding a version 1 message.
+type OrderMessage struct {
+	SchemaVersion int         `json:"schema_version"`
+	OrderID       int         `json:"order_id"`
+	CartID        int         `json:"cart_id"`
+	Items         []OrderItem `json:"items"`
+
+	CustomerID      int       `json:"customer_id,omitempty"`
+	AuthorizationID string    `json:"authorization_id,omitempty"`
+	CorrelationID   string    `json:"correlation_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+
+	// Order amounts (v3+) in minor units of Currency.
+	// Total = Subtotal - Discount + Tax + Shipping.
+	Currency       string `json:"currency,omitempty"`
+	Subtotal       int64  `json:"subtotal,omitempty"`
+	Discount       int64  `json:"discount,omitempty"`
+	Tax            int64  `json:"tax,omitempty"`
+	Shipping       int64  `json:"shipping,omitempty"`
+	ShippingMethod string `json:"shipping_method,omitempty"`
+	Total          int64  `json:"total,omitempty"`
+	PromotionCode  string `json:"promotion_code,omitempty"`
+}
+
+// Headers returns the AMQP headers to publish alongside the message.
+func Headers() map[string]interface{} {
+	return map[string]interface{}{SchemaVersionHeader: SchemaVersion}
+}
+
+// Validate checks the message against the schema for its version:
+//   - schema_version is between MinSchemaVersion and SchemaVersion
+//   - order_id and cart_id are positive
+//   - items is non-empty, and every product_id and quantity is positive
+//   - from version 2: customer_id is positive, correlation_id and
+//     created_at are set
+//   - from version 3: currency is set, amounts are non-negative and
+//     total = subtotal - discount + tax (+ shipping from version 4)
+//   - from version 4: shipping_method is set
+func (m OrderMessage) Validate() error {
+	if m.SchemaVersion < MinSchemaVersion || m.SchemaVersion > SchemaVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedVersion, m.SchemaVersion)
+	}
+	if m.OrderID < 1 {
+		return errors.New("order_id must be a positive integer")
+	}
+	if m.CartID < 1 {
+		return errors.New("cart_id must be a positive integer")
+	}
+	if len(m.Items) == 0 {
+		return errors.New("items must not be empty")
+	}
+	for i, item := range m.Items {
+		if item.ProductID < 1 {
+			return fmt.Errorf("items[%d].product_id must be a positive integer", i)
+		}
+		if item.Quantity < 1 {
+			return fmt.Errorf("items[%d].quantity must be a positive integer", i)
+		}
+	}
+
+	if m.SchemaVersion >= 2 {
+		if m.CustomerID < 1 {
+			return errors.New("customer_id must be a positive integer")
+		}
+		if m.CorrelationID == "" {
+			return errors.New("correlation_id is required")
+		}
+		if m.CreatedAt.IsZero() {
+			return errors.New("created_at is required")
+		}
+	}
+
+	if m.SchemaVersion >= 3 {
+		if m.Currency == "" {
+			return errors.New("currency is required")
+		}
+		if m.Subtotal < 0 || m.Discount < 0 || m.Tax < 0 || m.Shipping < 0 || m.Total < 0 {
+			return errors.New("amounts must not be negative")
+		}
+		if m.Total != m.Subtotal-m.Discount+m.Tax+m.Shipping {
+			return errors.New("total must equal subtotal - discount + tax + shipping")
+		}
+	}
+
+	if m.SchemaVersion >= 4 && m.ShippingMethod == "" {
+		return errors.New("shipping_method is required")
+	}
+	return nil
+}
+
+// Decode parses and validates an order message.
+//
+// The version is taken from the schema-version header, falling back to the
+// schema_version body field. Messages carrying neither were published before
+// versioning was introduced and have the same shape as version 1.
+func Decode(headers map[string]interface{}, body []byte) (OrderMessage, error) {
+	var msg OrderMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return OrderMessage{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+
+	version, ok, err := headerVersion(headers)
+	if err != nil {
+		return OrderMessage{}, err
+	}
+	switch {
+	case ok:
+		if msg.SchemaVersion != 0 && msg.SchemaVersion != version {
+			return OrderMessage{}, fmt.Errorf("schema version mismatch: header %d, body %d", version, msg.SchemaVersion)
+		}
+		msg.SchemaVersion = version
+	case msg.SchemaVersion == 0:
+		msg.SchemaVersion = 1
+	}
+
+	if err := msg.Validate(); err != nil {
+		return OrderMessage{}, err
+	}
+	return msg, nil
+}
+
+// headerVersion reads the schema-version header. AMQP tables may decode
+// integers as any of several widths depending on the publisher.
+func headerVersion(headers map[string]interface{}) (int, bool, error) {
+	raw, ok := headers[SchemaVersionHeader]
+	if !ok {
+		return 0, false, nil
+	}
+
+	switch v := raw.(type) {
+	case int:
+		return v, true, nil
+	case int8:
+		return int(v), true, nil
+	case int16:
+		return int(v), true, nil
+	case int32:
+		return int(v), true, nil
+	case int64:
+		return int(v), true, nil
+	case uint8:
+		return int(v), true, nil
+	case uint16:
+		return int(v), true, nil
+	case uint32:
+		return int(v), true, nil
+	case string:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %q", ErrUnsupportedVersion, v)
+		}
+		return n, true, nil
+	default:
+		return 0, false, fmt.Errorf("%w: header of type %T", ErrUnsupportedVersion, raw)
+	}
+}
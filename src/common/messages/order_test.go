@@ -0,0 +1,131 @@
+package messages
+
+import (
+	"errors"
+	"testing"
+)
+
+// Payloads as each schema version published them.
+const (
+	orderV1 = `{"order_id":1,"cart_id":2,"items":[{"product_id":3,"quantity":1}]}`
+
+	orderV2 = `{"schema_version":2,"order_id":1,"cart_id":2,
+		"items":[{"product_id":3,"quantity":1,"sku":"SKU-3","weight":500}],
+		"customer_id":7,"authorization_id":"auth-1","correlation_id":"corr-1",
+		"created_at":"2024-01-02T03:04:05Z"}`
+
+	orderV3 = `{"schema_version":3,"order_id":1,"cart_id":2,
+		"items":[{"product_id":3,"quantity":1}],
+		"customer_id":7,"correlation_id":"corr-1","created_at":"2024-01-02T03:04:05Z",
+		"currency":"USD","subtotal":1000,"discount":100,"tax":90,"total":990,
+		"promotion_code":"SAVE10"}`
+
+	orderV4 = `{"schema_version":4,"order_id":1,"cart_id":2,
+		"items":[{"product_id":3,"quantity":1}],
+		"customer_id":7,"correlation_id":"corr-1","created_at":"2024-01-02T03:04:05Z",
+		"currency":"USD","subtotal":1000,"discount":0,"tax":80,"shipping":500,
+		"shipping_method":"standard","total":1580}`
+)
+
+func TestDecodeVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]interface{}
+		body    string
+		version int
+	}{
+		{"v1 without header", nil, orderV1, 1},
+		{"v1 with header", map[string]interface{}{SchemaVersionHeader: int32(1)}, orderV1, 1},
+		{"v2 body only", nil, orderV2, 2},
+		{"v2 with header", map[string]interface{}{SchemaVersionHeader: int64(2)}, orderV2, 2},
+		{"v3 body only", nil, orderV3, 3},
+		{"v3 with header", map[string]interface{}{SchemaVersionHeader: uint8(3)}, orderV3, 3},
+		{"v4 body only", nil, orderV4, 4},
+		{"v4 with header", map[string]interface{}{SchemaVersionHeader: 4}, orderV4, 4},
+		{"v4 with string header", map[string]interface{}{SchemaVersionHeader: "4"}, orderV4, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := Decode(tt.headers, []byte(tt.body))
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if msg.SchemaVersion != tt.version {
+				t.Errorf("SchemaVersion = %d, want %d", msg.SchemaVersion, tt.version)
+			}
+			if msg.OrderID != 1 || msg.CartID != 2 || len(msg.Items) != 1 {
+				t.Errorf("decoded %+v", msg)
+			}
+		})
+	}
+}
+
+func TestDecodeFields(t *testing.T) {
+	msg, err := Decode(nil, []byte(orderV2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.CustomerID != 7 || msg.AuthorizationID != "auth-1" || msg.Items[0].SKU != "SKU-3" || msg.Items[0].Weight != 500 {
+		t.Errorf("v2 fields not decoded: %+v", msg)
+	}
+
+	msg, err = Decode(nil, []byte(orderV4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Shipping != 500 || msg.ShippingMethod != "standard" || msg.Total != 1580 {
+		t.Errorf("v4 fields not decoded: %+v", msg)
+	}
+}
+
+func TestDecodeUnknownVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]interface{}
+		body    string
+	}{
+		{"future header", map[string]interface{}{SchemaVersionHeader: int32(SchemaVersion + 1)}, orderV1},
+		{"zero header", map[string]interface{}{SchemaVersionHeader: int32(0)}, orderV1},
+		{"negative header", map[string]interface{}{SchemaVersionHeader: int32(-1)}, orderV1},
+		{"non-numeric header", map[string]interface{}{SchemaVersionHeader: "abc"}, orderV4},
+		{"unsupported header type", map[string]interface{}{SchemaVersionHeader: 4.0}, orderV4},
+		{"future body", nil, `{"schema_version":99,"order_id":1,"cart_id":2,"items":[{"product_id":3,"quantity":1}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.headers, []byte(tt.body))
+			if !errors.Is(err, ErrUnsupportedVersion) {
+				t.Fatalf("Decode error = %v, want ErrUnsupportedVersion", err)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]interface{}
+		body    string
+	}{
+		{"not JSON", nil, `{`},
+		{"header/body mismatch", map[string]interface{}{SchemaVersionHeader: int32(3)}, orderV4},
+		{"no items", nil, `{"order_id":1,"cart_id":2,"items":[]}`},
+		{"bad quantity", nil, `{"order_id":1,"cart_id":2,"items":[{"product_id":3,"quantity":0}]}`},
+		{"v1 body under v2 header", map[string]interface{}{SchemaVersionHeader: int32(2)}, orderV1},
+		{"v3 wrong total", nil, `{"schema_version":3,"order_id":1,"cart_id":2,
+			"items":[{"product_id":3,"quantity":1}],
+			"customer_id":7,"correlation_id":"c","created_at":"2024-01-02T03:04:05Z",
+			"currency":"USD","subtotal":1000,"total":1}`},
+		{"v4 missing shipping_method", nil, `{"schema_version":4,"order_id":1,"cart_id":2,
+			"items":[{"product_id":3,"quantity":1}],
+			"customer_id":7,"correlation_id":"c","created_at":"2024-01-02T03:04:05Z",
+			"currency":"USD","subtotal":1000,"total":1000}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Decode(tt.headers, []byte(tt.body)); err == nil {
+				t.Fatal("Decode succeeded, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package messages
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// OrderStatusExchange is the durable topic exchange warehouse-consumer
+// publishes order status events to, with the status as routing key, and
+// shopping-cart-service consumes.
+const OrderStatusExchange = "orders.status"
+
+// OrderStatusEvent is the event type of OrderStatus.
+const OrderStatusEvent = "order.status"
+
+// Fulfillment states reported by the warehouse. An order is received
+// first, then either fulfilled or backordered.
+const (
+	StatusReceived    = "received"
+	StatusFulfilled   = "fulfilled"
+	StatusBackordered = "backordered"
+)
+
+// OrderStatus is published by the warehouse as an order moves through
+// fulfillment.
+type OrderStatus struct {
+	Event         string    `json:"event"`
+	OrderID       int       `json:"order_id"`
+	Status        string    `json:"status"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	OccurredAt    time.Time `json:"occurred_at"`
+
+	// Lines that could not be filled from stock (backordered only).
+	Backordered []OrderItem `json:"backordered,omitempty"`
+}
+
+// Validate checks the event has an order and a known status.
+func (s OrderStatus) Validate() error {
+	if s.Event != OrderStatusEvent {
+		return fmt.Errorf("unexpected event %q", s.Event)
+	}
+	if s.OrderID < 1 {
+		return errors.New("order_id must be a positive integer")
+	}
+	switch s.Status {
+	case StatusReceived, StatusFulfilled, StatusBackordered:
+	default:
+		return fmt.Errorf("unknown order status %q", s.Status)
+	}
+	if s.OccurredAt.IsZero() {
+		return errors.New("occurred_at is required")
+	}
+	return nil
+}
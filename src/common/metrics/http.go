@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"common/routes"
+)
+
+var (
+	httpRequests = NewCounter("http_requests_total",
+		"HTTP requests by method, route and status.",
+		"method", "route", "status")
+	httpDuration = NewHistogram("http_request_duration_seconds",
+		"HTTP request latency in seconds by method, route and status.",
+		DefBuckets, "method", "route", "status")
+)
+
+// Instrument wraps next so every request is counted and timed under the
+// route names gives it.
+func Instrument(next http.Handler, names *routes.Namer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := names.Name(r)
+		rec := &statusRecorder{ResponseWriter: w}
+		start := time.Now()
+
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		code := strconv.Itoa(status)
+		httpRequests.Inc(r.Method, route, code)
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route, code)
+	})
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
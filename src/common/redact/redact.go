@@ -0,0 +1,57 @@
+// Package redact masks card numbers (PANs) so they never reach the logs.
+package redact
+
+import (
+	"io"
+	"regexp"
+)
+
+// panPattern matches 13 to 19 digits, optionally separated by single
+// spaces or dashes, as a standalone word.
+var panPattern = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+
+// PAN masks every card number in s down to its last four digits, keeping
+// separators: "4111-1111-1111-1111" becomes "****-****-****-1111".
+func PAN(s string) string {
+	return string(mask([]byte(s)))
+}
+
+func mask(b []byte) []byte {
+	return panPattern.ReplaceAllFunc(b, func(m []byte) []byte {
+		out := make([]byte, len(m))
+		copy(out, m)
+
+		keep := 4
+		for i := len(out) - 1; i >= 0; i-- {
+			if out[i] < '0' || out[i] > '9' {
+				continue
+			}
+			if keep > 0 {
+				keep--
+				continue
+			}
+			out[i] = '*'
+		}
+		return out
+	})
+}
+
+// Writer masks card numbers in everything written through it.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter wraps w. Install it with log.SetOutput(redact.NewWriter(os.Stderr))
+// so that every log line is masked.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write masks p and writes it to the underlying writer. It reports len(p)
+// on success since masking never changes the length.
+func (rw *Writer) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write(mask(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,62 @@
+// Package routes names HTTP requests by route, for metric labels and span
+// names. Names come only from the mux patterns and a fixed list of
+// templates, so client-supplied paths cannot create new names.
+package routes
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Unmatched names requests no mux pattern matches.
+const Unmatched = "unmatched"
+
+// Namer names the requests served by a mux.
+type Namer struct {
+	mux       *http.ServeMux
+	templates [][]string
+}
+
+// New returns a Namer for mux. templates are the paths served under
+// subtree patterns, with a {id} segment standing for any one segment,
+// e.g. "/shopping-carts/{id}/checkout".
+func New(mux *http.ServeMux, templates ...string) *Namer {
+	n := &Namer{mux: mux}
+	for _, t := range templates {
+		n.templates = append(n.templates, strings.Split(t, "/"))
+	}
+	return n
+}
+
+// Name returns the route of r: the mux pattern for exact patterns; for
+// subtree patterns ("/carts/"), the first template matching the path, or
+// the pattern itself when none does; Unmatched when no pattern matches.
+func (n *Namer) Name(r *http.Request) string {
+	_, pattern := n.mux.Handler(r)
+	switch {
+	case pattern == "":
+		return Unmatched
+	case !strings.HasSuffix(pattern, "/"):
+		return pattern
+	}
+
+	segments := strings.Split(r.URL.Path, "/")
+	for _, t := range n.templates {
+		if strings.HasPrefix(strings.Join(t, "/"), pattern) && match(t, segments) {
+			return strings.Join(t, "/")
+		}
+	}
+	return pattern
+}
+
+func match(template, segments []string) bool {
+	if len(template) != len(segments) {
+		return false
+	}
+	for i, seg := range template {
+		if seg != "{id}" && seg != segments[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	mux := http.NewServeMux()
+	noop := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	mux.Handle("/shopping-cart", noop)
+	mux.Handle("/shopping-carts/", noop)
+	mux.Handle("/orders/", noop)
+	names := New(mux, "/shopping-carts/{id}", "/shopping-carts/{id}/checkout", "/orders/{id}")
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/shopping-cart", "/shopping-cart"},
+		{"/shopping-carts/42", "/shopping-carts/{id}"},
+		{"/shopping-carts/42/checkout", "/shopping-carts/{id}/checkout"},
+		{"/orders/7", "/orders/{id}"},
+		// Unknown paths under a subtree pattern collapse to the pattern
+		{"/shopping-carts/42/wp-login.php", "/shopping-carts/"},
+		{"/shopping-carts/admin/config/env", "/shopping-carts/"},
+		{"/orders/7/checkout", "/orders/"},
+		{"/nothing-here", Unmatched},
+	}
+	for _, tt := range tests {
+		if got := names.Name(httptest.NewRequest(http.MethodGet, tt.path, nil)); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	batchSize     = 256
+	queueSize     = 4096
+	flushInterval = time.Second
+)
+
+// exporter writes one OTLP/JSON ExportTraceServiceRequest.
+type exporter interface {
+	export(body []byte) error
+	close() error
+}
+
+var (
+	mu      sync.RWMutex
+	pipe    *pipeline
+	dropped int64
+)
+
+// pipeline batches ended spans on a background goroutine.
+type pipeline struct {
+	service string
+	exp     exporter
+	spans   chan *Span
+	done    chan struct{}
+}
+
+// Init starts exporting spans for service and returns a shutdown func that
+// flushes what is queued. The destination comes from the environment:
+//
+//	OTEL_EXPORTER_OTLP_ENDPOINT  OTLP/HTTP collector base URL (JSON is
+//	                             POSTed to {endpoint}/v1/traces)
+//	TRACE_FILE                   append OTLP/JSON requests to this file,
+//	                             one per line, for offline tests
+//
+// With neither set spans are not recorded, but trace context is still
+// propagated so services downstream can record theirs.
+func Init(service string) (func(context.Context) error, error) {
+	var exp exporter
+	switch {
+	case os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "":
+		endpoint := strings.TrimSuffix(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"), "/")
+		exp = &otlpHTTP{url: endpoint + "/v1/traces", client: &http.Client{Timeout: 5 * time.Second}}
+		log.Printf("Exporting traces to %s/v1/traces", endpoint)
+	case os.Getenv("TRACE_FILE") != "":
+		path := os.Getenv("TRACE_FILE")
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("open trace file: %w", err)
+		}
+		exp = &fileExporter{f: f, w: bufio.NewWriter(f)}
+		log.Printf("Writing traces to %s", path)
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	p := &pipeline{
+		service: service,
+		exp:     exp,
+		spans:   make(chan *Span, queueSize),
+		done:    make(chan struct{}),
+	}
+	go p.run()
+
+	mu.Lock()
+	pipe = p
+	mu.Unlock()
+
+	return func(ctx context.Context) error {
+		mu.Lock()
+		pipe = nil
+		mu.Unlock()
+		close(p.spans)
+
+		select {
+		case <-p.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return p.exp.close()
+	}, nil
+}
+
+// record queues an ended span, dropping it if the exporter is behind.
+func record(s *Span) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if pipe == nil {
+		return
+	}
+	select {
+	case pipe.spans <- s:
+	default:
+		if n := atomic.AddInt64(&dropped, 1); n == 1 || n%1000 == 0 {
+			log.Printf("WARN: trace queue full, %d spans dropped", n)
+		}
+	}
+}
+
+func (p *pipeline) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		body, err := json.Marshal(p.request(batch))
+		if err == nil {
+			err = p.exp.export(body)
+		}
+		if err != nil {
+			log.Printf("WARN: exporting %d spans failed: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s, ok := <-p.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// OTLP/JSON encoding (opentelemetry-proto ExportTraceServiceRequest).
+// IDs are hex strings and 64-bit integers are decimal strings.
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              Kind           `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+func (p *pipeline) request(batch []*Span) otlpRequest {
+	spans := make([]otlpSpan, 0, len(batch))
+	for _, s := range batch {
+		spans = append(spans, s.otlp())
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: []otlpKeyValue{keyValue("service.name", p.service)}},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "tracing"}, Spans: spans}},
+	}}}
+}
+
+func (s *Span) otlp() otlpSpan {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := otlpSpan{
+		TraceID:           hex.EncodeToString(s.sc.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.sc.SpanID[:]),
+		Name:              s.name,
+		Kind:              s.kind,
+		StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+	}
+	if s.parent != [8]byte{} {
+		out.ParentSpanID = hex.EncodeToString(s.parent[:])
+	}
+	for _, a := range s.attrs {
+		out.Attributes = append(out.Attributes, keyValue(a.key, a.value))
+	}
+	if s.errMsg != "" {
+		out.Status = otlpStatus{Code: 2, Message: s.errMsg}
+	}
+	return out
+}
+
+func keyValue(key string, value interface{}) otlpKeyValue {
+	var v otlpValue
+	switch x := value.(type) {
+	case string:
+		v.StringValue = &x
+	case int:
+		n := strconv.Itoa(x)
+		v.IntValue = &n
+	case int64:
+		n := strconv.FormatInt(x, 10)
+		v.IntValue = &n
+	case float64:
+		v.DoubleValue = &x
+	case bool:
+		v.BoolValue = &x
+	default:
+		str := fmt.Sprint(x)
+		v.StringValue = &str
+	}
+	return otlpKeyValue{Key: key, Value: v}
+}
+
+// otlpHTTP posts requests to an OTLP/HTTP collector.
+type otlpHTTP struct {
+	url    string
+	client *http.Client
+}
+
+func (e *otlpHTTP) export(body []byte) error {
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpHTTP) close() error { return nil }
+
+// fileExporter appends one request per line.
+type fileExporter struct {
+	f *os.File
+	w *bufio.Writer
+}
+
+func (e *fileExporter) export(body []byte) error {
+	if _, err := e.w.Write(append(body, '\n')); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *fileExporter) close() error {
+	if err := e.w.Flush(); err != nil {
+		e.f.Close()
+		return err
+	}
+	return e.f.Close()
+}
@@ -0,0 +1,142 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("TRACE_FILE", path)
+
+	stop, err := Init("test-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, parent := Start(context.Background(), "checkout", KindInternal)
+	_, child := Start(ctx, "orders publish", KindProducer)
+	child.SetAttribute("order.id", 7)
+	child.SetAttribute("messaging.system", "rabbitmq")
+	child.SetAttribute("retry", true)
+	child.SetAttribute("amount", 12.5)
+	child.SetError(errors.New("broker unreachable"))
+	child.End()
+	child.End() // a second End is ignored
+	parent.End()
+
+	if err := stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readSpans(t, path)
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	byName := map[string]otlpSpan{}
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+
+	p, c := byName["checkout"], byName["orders publish"]
+	if p.TraceID != parent.Context().TraceIDString() || c.TraceID != p.TraceID {
+		t.Errorf("trace IDs %s and %s, want %s", p.TraceID, c.TraceID, parent.Context().TraceIDString())
+	}
+	if c.ParentSpanID != p.SpanID || p.ParentSpanID != "" {
+		t.Errorf("parent IDs: child %q (want %q), root %q", c.ParentSpanID, p.SpanID, p.ParentSpanID)
+	}
+	if c.Kind != KindProducer || p.Kind != KindInternal {
+		t.Errorf("kinds %d and %d", c.Kind, p.Kind)
+	}
+	if c.Status.Code != 2 || c.Status.Message != "broker unreachable" || p.Status.Code != 0 {
+		t.Errorf("statuses %+v and %+v", c.Status, p.Status)
+	}
+	if c.StartTimeUnixNano == "" || c.EndTimeUnixNano < c.StartTimeUnixNano {
+		t.Errorf("times %s..%s", c.StartTimeUnixNano, c.EndTimeUnixNano)
+	}
+
+	attrs := map[string]otlpValue{}
+	for _, kv := range c.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	if v := attrs["order.id"].IntValue; v == nil || *v != "7" {
+		t.Errorf("order.id = %+v, want intValue \"7\"", attrs["order.id"])
+	}
+	if v := attrs["messaging.system"].StringValue; v == nil || *v != "rabbitmq" {
+		t.Errorf("messaging.system = %+v", attrs["messaging.system"])
+	}
+	if v := attrs["retry"].BoolValue; v == nil || !*v {
+		t.Errorf("retry = %+v", attrs["retry"])
+	}
+	if v := attrs["amount"].DoubleValue; v == nil || *v != 12.5 {
+		t.Errorf("amount = %+v", attrs["amount"])
+	}
+
+	// Spans ended after shutdown are not recorded
+	_, late := Start(context.Background(), "late", KindInternal)
+	late.End()
+	if n := len(readSpans(t, path)); n != 2 {
+		t.Errorf("got %d spans after shutdown, want 2", n)
+	}
+}
+
+func TestUnsampledSpansAreNotExported(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("TRACE_FILE", path)
+
+	stop, err := Init("test-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, span := Start(ContextWithRemote(context.Background(), sc), "unsampled", KindServer)
+	span.End()
+	if err := stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(readSpans(t, path)); n != 0 {
+		t.Errorf("got %d spans, want 0", n)
+	}
+}
+
+// readSpans parses the file exporter's output: one OTLP/JSON
+// ExportTraceServiceRequest per line.
+func readSpans(t *testing.T, path string) []otlpSpan {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var spans []otlpSpan
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var req otlpRequest
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			t.Fatalf("invalid OTLP/JSON line: %v", err)
+		}
+		for _, rs := range req.ResourceSpans {
+			attrs := rs.Resource.Attributes
+			if len(attrs) != 1 || attrs[0].Key != "service.name" || *attrs[0].Value.StringValue != "test-service" {
+				t.Errorf("resource attributes %+v", attrs)
+			}
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return spans
+}
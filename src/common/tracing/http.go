@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"common/routes"
+)
+
+// Middleware runs next with every request in a server span named after
+// the method and the route names gives it, continuing the trace of an
+// incoming traceparent header. The response carries the traceparent of
+// the server span so callers can look the trace up.
+func Middleware(next http.Handler, names *routes.Namer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := names.Name(r)
+
+		ctx := ExtractHTTP(r.Context(), r.Header)
+		ctx, span := Start(ctx, r.Method+" "+route, KindServer)
+		defer span.End()
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		span.SetAttribute("http.route", route)
+
+		w.Header().Set(TraceparentHeader, span.Context().Traceparent())
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		span.SetAttribute("http.response.status_code", status)
+		if status >= 500 {
+			span.SetError(errStatus(status))
+		}
+	})
+}
+
+// Transport wraps base (http.DefaultTransport when nil) so every outgoing
+// request made with a context runs in a client span and carries its
+// traceparent.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return roundTripper{base}
+}
+
+type roundTripper struct {
+	base http.RoundTripper
+}
+
+func (t roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx, span := Start(r.Context(), r.Method+" "+r.URL.Host, KindClient)
+	defer span.End()
+	span.SetAttribute("http.request.method", r.Method)
+	span.SetAttribute("url.full", r.URL.String())
+
+	// RoundTrippers must not modify the caller's request
+	r = r.Clone(ctx)
+	InjectHTTP(ctx, r.Header)
+
+	resp, err := t.base.RoundTrip(r)
+	if err != nil {
+		span.SetError(err)
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	if resp.StatusCode >= 500 {
+		span.SetError(errStatus(resp.StatusCode))
+	}
+	return resp, nil
+}
+
+// InjectHTTP sets the traceparent header from the span in ctx.
+func InjectHTTP(ctx context.Context, h http.Header) {
+	if sc := SpanContextFromContext(ctx); sc.IsValid() {
+		h.Set(TraceparentHeader, sc.Traceparent())
+	}
+}
+
+// ExtractHTTP returns ctx with the traceparent header as remote parent,
+// or ctx unchanged if there is none.
+func ExtractHTTP(ctx context.Context, h http.Header) context.Context {
+	if sc, ok := ParseTraceparent(h.Get(TraceparentHeader)); ok {
+		return ContextWithRemote(ctx, sc)
+	}
+	return ctx
+}
+
+type errStatus int
+
+func (e errStatus) Error() string {
+	return fmt.Sprintf("HTTP %d %s", int(e), http.StatusText(int(e)))
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
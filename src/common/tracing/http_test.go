@@ -0,0 +1,49 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"common/routes"
+)
+
+func TestTransportAndMiddleware(t *testing.T) {
+	var serverSpan SpanContext
+	var serverParent [8]byte
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orders/", func(w http.ResponseWriter, r *http.Request) {
+		span := FromContext(r.Context())
+		serverSpan, serverParent = span.Context(), span.parent
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(Middleware(mux, routes.New(mux, "/orders/{id}")))
+	defer srv.Close()
+
+	ctx, root := Start(context.Background(), "root", KindInternal)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/orders/7", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := (&http.Client{Transport: Transport(nil)}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if req.Header.Get(TraceparentHeader) != "" {
+		t.Error("Transport modified the caller's request")
+	}
+	if serverSpan.TraceID != root.Context().TraceID {
+		t.Fatal("server span is not in the caller's trace")
+	}
+	// The server span's parent is the client span, itself a child of root
+	if serverParent == root.Context().SpanID || serverParent == [8]byte{} {
+		t.Error("server span is not parented to the client span")
+	}
+	got, ok := ParseTraceparent(resp.Header.Get(TraceparentHeader))
+	if !ok || got != serverSpan {
+		t.Errorf("response traceparent %q, want the server span %s", resp.Header.Get(TraceparentHeader), serverSpan.Traceparent())
+	}
+}
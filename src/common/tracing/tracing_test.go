@@ -0,0 +1,143 @@
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		ok      bool
+		sampled bool
+	}{
+		{"sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"not sampled", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", true, false},
+		{"surrounding space", " 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01 ", true, true},
+		{"future version", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true, true},
+		{"future version with extra fields", "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future", true, true},
+		{"version 00 with extra fields", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false, false},
+		{"forbidden version ff", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false, false},
+		{"zero trace ID", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false, false},
+		{"zero span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false, false},
+		{"short trace ID", "00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", false, false},
+		{"non-hex span ID", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", false, false},
+		{"non-hex flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0g", false, false},
+		{"missing flags", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, ok := ParseTraceparent(tt.value)
+			if ok != tt.ok {
+				t.Fatalf("ParseTraceparent(%q) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+			if ok && sc.Sampled != tt.sampled {
+				t.Errorf("Sampled = %v, want %v", sc.Sampled, tt.sampled)
+			}
+			if ok && sc.TraceIDString() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("TraceID = %s", sc.TraceIDString())
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	const value = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(value)
+	if !ok {
+		t.Fatal("valid traceparent rejected")
+	}
+	if got := sc.Traceparent(); got != value {
+		t.Errorf("Traceparent() = %q, want %q", got, value)
+	}
+}
+
+func TestHTTPInjectExtract(t *testing.T) {
+	ctx, span := Start(context.Background(), "client", KindClient)
+	h := http.Header{}
+	InjectHTTP(ctx, h)
+
+	remote := SpanContextFromContext(ExtractHTTP(context.Background(), h))
+	if remote != span.Context() {
+		t.Fatalf("extracted %+v, want %+v", remote, span.Context())
+	}
+
+	// The next span continues the trace as a child of the remote span
+	_, child := Start(ExtractHTTP(context.Background(), h), "server", KindServer)
+	if child.Context().TraceID != span.Context().TraceID {
+		t.Error("child span started a new trace")
+	}
+	if child.parent != span.Context().SpanID {
+		t.Error("child span is not parented to the remote span")
+	}
+}
+
+func TestAMQPInjectExtract(t *testing.T) {
+	ctx, span := Start(context.Background(), "publish", KindProducer)
+	headers := map[string]interface{}{"schema-version": 4}
+	Inject(ctx, headers)
+
+	if headers["schema-version"] != 4 {
+		t.Error("Inject changed other headers")
+	}
+	remote := SpanContextFromContext(Extract(context.Background(), headers))
+	if remote != span.Context() {
+		t.Fatalf("extracted %+v, want %+v", remote, span.Context())
+	}
+}
+
+func TestExtractWithoutTraceparent(t *testing.T) {
+	for _, headers := range []map[string]interface{}{
+		nil,
+		{},
+		{TraceparentHeader: 42},
+		{TraceparentHeader: "garbage"},
+	} {
+		if sc := SpanContextFromContext(Extract(context.Background(), headers)); sc.IsValid() {
+			t.Errorf("Extract(%v) = %+v, want no span context", headers, sc)
+		}
+	}
+
+	// Without a parent a new trace is started, sampled
+	_, span := Start(Extract(context.Background(), nil), "root", KindInternal)
+	if !span.Context().IsValid() || !span.Context().Sampled || span.parent != [8]byte{} {
+		t.Errorf("root span context %+v", span.Context())
+	}
+}
+
+func TestInjectWithoutSpan(t *testing.T) {
+	headers := map[string]interface{}{}
+	Inject(context.Background(), headers)
+	h := http.Header{}
+	InjectHTTP(context.Background(), h)
+	if len(headers) != 0 || len(h) != 0 {
+		t.Errorf("headers written without a span: %v %v", headers, h)
+	}
+}
+
+func TestDetach(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ctx, span := Start(ctx, "request", KindServer)
+	detached := Detach(ctx)
+	cancel()
+
+	if detached.Err() != nil {
+		t.Error("detached context was cancelled with its parent")
+	}
+	if SpanContextFromContext(detached) != span.Context() {
+		t.Error("detached context lost the trace")
+	}
+}
+
+func TestNilSpan(t *testing.T) {
+	var span *Span
+	span.SetAttribute("k", "v")
+	span.SetError(http.ErrHandlerTimeout)
+	span.End()
+	if span.Context().IsValid() {
+		t.Error("nil span has a valid context")
+	}
+}
@@ -1,3 +1,7 @@
 module credit-card-authorizer
 
 go 1.21
+
+require common v0.0.0
+
+replace common => ../common
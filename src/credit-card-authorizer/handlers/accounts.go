@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"credit-card-authorizer/storage"
+)
+
+// handleListAccounts implements GET /accounts.
+func (h *Handler) handleListAccounts(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"accounts": h.accounts.ListAccounts(),
+	})
+}
+
+// handleAccount implements
+//   - GET /accounts/{customerId} – inspect an account
+//   - PUT /accounts/{customerId} – seed or replace an account with
+//     {"credit_limit": n, "balance": n}
+func (h *Handler) handleAccount(w http.ResponseWriter, r *http.Request) {
+	idStr := strings.TrimPrefix(r.URL.Path, "/credit-card-authorizer/accounts/")
+	customerID, err := strconv.Atoi(idStr)
+	if err != nil || customerID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "customer ID must be a positive integer")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		acct, err := h.accounts.GetAccount(customerID)
+		if err != nil {
+			if errors.Is(err, storage.ErrAccountNotFound) {
+				h.writeError(w, http.StatusNotFound, "ACCOUNT_NOT_FOUND", "Account not found")
+				return
+			}
+			h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve account")
+			return
+		}
+		writeJSON(w, http.StatusOK, acct)
+
+	case http.MethodPut:
+		var payload struct {
+			CreditLimit int64 `json:"credit_limit"`
+			Balance     int64 `json:"balance"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
+			return
+		}
+		if payload.CreditLimit < 0 || payload.Balance < 0 {
+			h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "credit_limit and balance must be non-negative")
+			return
+		}
+		writeJSON(w, http.StatusOK, h.accounts.PutAccount(customerID, payload.CreditLimit, payload.Balance))
+
+	default:
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+	}
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"common/metrics"
+
+	"credit-card-authorizer/models"
+	"credit-card-authorizer/storage"
+)
+
+var operationsTotal = metrics.NewCounter("cca_authorization_operations_total",
+	"Successful authorization lifecycle operations by action (capture, void, refund, expire).", "action")
+
+// handleAuthorizationOperations dispatches
+//   - GET  /authorizations/{id}
+//   - POST /authorizations/{id}/capture
+//   - POST /authorizations/{id}/void
+//   - POST /authorizations/{id}/refund
+//
+// under both the /credit-card-authorizer prefix and the short path.
+func (h *Handler) handleAuthorizationOperations(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/credit-card-authorizer")
+	path = strings.TrimPrefix(path, "/authorizations/")
+
+	id, action, _ := strings.Cut(path, "/")
+	if id == "" {
+		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "Endpoint not found")
+		return
+	}
+
+	if action == "" {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		auth, err := h.store.GetAuthorization(id)
+		if err != nil {
+			h.writeStoreError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, auth)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	// capture 和 refund 可选地带 amount；不传表示全额
+	var payload struct {
+		Amount int64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
+		return
+	}
+
+	// released 是要还回客户额度的金额
+	var (
+		auth     models.Authorization
+		released int64
+		err      error
+	)
+	switch action {
+	case "capture":
+		// 部分 capture：没 capture 的部分释放
+		auth, err = h.store.Capture(id, payload.Amount)
+		released = auth.Amount - auth.CapturedAmount
+	case "void":
+		auth, err = h.store.Void(id)
+		released = auth.Amount
+	case "refund":
+		auth, released, err = h.store.Refund(id, payload.Amount)
+	default:
+		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "Endpoint not found")
+		return
+	}
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	if auth.CustomerID > 0 {
+		h.accounts.Release(auth.CustomerID, released)
+	}
+
+	operationsTotal.Inc(action)
+	log.Printf("Authorization %s %s (status=%s)", id, action, auth.Status)
+	writeJSON(w, http.StatusOK, auth)
+}
+
+// ReleaseExpiredHold returns the credit reserved by a hold that expired
+// without being captured or voided. It is the store sweep's OnExpire hook.
+func (h *Handler) ReleaseExpiredHold(auth models.Authorization) {
+	if auth.CustomerID > 0 {
+		h.accounts.Release(auth.CustomerID, auth.Amount)
+	}
+	operationsTotal.Inc("expire")
+	log.Printf("Authorization %s expired", auth.AuthorizationID)
+}
+
+// handleFindAuthorization serves GET /authorizations?idempotency_key=K,
+// returning the authorization created with that Idempotency-Key.
+func (h *Handler) handleFindAuthorization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	key := r.URL.Query().Get("idempotency_key")
+	if key == "" {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "idempotency_key is required")
+		return
+	}
+	auth, err := h.store.FindByIdempotencyKey(key)
+	if err != nil {
+		h.writeStoreError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, auth)
+}
+
+// writeStoreError maps storage errors to HTTP responses.
+func (h *Handler) writeStoreError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		h.writeError(w, http.StatusNotFound, "AUTHORIZATION_NOT_FOUND", "Authorization not found")
+	case errors.Is(err, storage.ErrInvalidTransition):
+		h.writeError(w, http.StatusConflict, "INVALID_STATE_TRANSITION", "Operation not allowed in the authorization's current state")
+	case errors.Is(err, storage.ErrInvalidAmount):
+		h.writeError(w, http.StatusBadRequest, "INVALID_AMOUNT", "Amount exceeds what is available")
+	default:
+		log.Printf("ERROR: authorization operation failed: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Authorization operation failed")
+	}
+}
@@ -1,13 +1,48 @@
 package handlers
 
 import (
+	crand "crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"math/rand"
 	"net/http"
 	"regexp"
+	"sync"
 	"time"
+
+	"common/metrics"
+
+	"credit-card-authorizer/models"
+	"credit-card-authorizer/risk"
+	"credit-card-authorizer/storage"
+)
+
+var currencyFormat = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// maxAmount 是单笔授权金额的上限（分），远高于任何真实订单，
+// 挡住离谱的金额，额度计算也不会溢出。
+const maxAmount int64 = 1_000_000_000_000
+
+// IdempotencyKeyHeader 由调用方（购物车的 checkout）在授权前生成并保存，
+// 同一个 key 重复授权只返回第一次的结果，也可以用它查回授权再 void。
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// 授权结果计数，拒绝按原因码细分（风控规则码、PAYMENT_DECLINED、INSUFFICIENT_FUNDS）
+var (
+	authorizationsTotal = metrics.NewCounter("cca_authorizations_total",
+		"Authorization decisions by result (approved, declined).", "result")
+	declinesTotal = metrics.NewCounter("cca_declines_total",
+		"Declined authorizations by decline code.", "code")
 )
 
+// recordDecline 记录一次拒绝。
+func recordDecline(code string) {
+	authorizationsTotal.Inc("declined")
+	declinesTotal.Inc(code)
+}
+
 type ErrorResponse struct {
 	Error   string  `json:"error"`
 	Message string  `json:"message"`
@@ -15,21 +50,67 @@ type ErrorResponse struct {
 }
 
 type Handler struct {
-	rng *rand.Rand
+	store    *storage.MemoryStore
+	vault    *storage.TokenVault
+	accounts *storage.AccountStore
+	risk     *risk.Engine
+
+	// approvalRate 是普通卡号（非测试卡）的授权概率，0.0 ~ 1.0
+	approvalRate float64
+	// timeoutDelay 是超时测试卡挂起的最长时间
+	timeoutDelay time.Duration
+
+	rngMu sync.Mutex // rand.Rand 不是并发安全的
+	rng   *rand.Rand
 }
 
-func NewHandler() *Handler {
+func NewHandler(store *storage.MemoryStore, vault *storage.TokenVault, accounts *storage.AccountStore, riskEngine *risk.Engine, approvalRate float64, timeoutDelay time.Duration) *Handler {
 	return &Handler{
-		rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+		store:        store,
+		vault:        vault,
+		accounts:     accounts,
+		risk:         riskEngine,
+		approvalRate: approvalRate,
+		timeoutDelay: timeoutDelay,
+		rng:          rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// Routes lists the paths served under the subtree patterns registered by
+// RegisterRoutes, for naming requests in metrics and traces.
+var Routes = []string{
+	"/credit-card-authorizer/authorizations/{id}",
+	"/credit-card-authorizer/authorizations/{id}/capture",
+	"/credit-card-authorizer/authorizations/{id}/void",
+	"/credit-card-authorizer/authorizations/{id}/refund",
+	"/credit-card-authorizer/accounts/{id}",
+	"/authorizations/{id}",
+	"/authorizations/{id}/capture",
+	"/authorizations/{id}/void",
+	"/authorizations/{id}/refund",
+}
+
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	// ✅ OpenAPI 里定义的路径
 	mux.HandleFunc("/credit-card-authorizer/authorize", h.handleAuthorize)
+	// 卡号换 token，之后用 card_token 授权，卡号不再经过其他服务
+	mux.HandleFunc("/credit-card-authorizer/tokenize", h.handleTokenize)
+	// 授权之后的 capture / void / refund / 查询
+	mux.HandleFunc("/credit-card-authorizer/authorizations/", h.handleAuthorizationOperations)
+	// 按 Idempotency-Key 查授权（调用方崩溃后找回 hold）
+	mux.HandleFunc("/credit-card-authorizer/authorizations", h.handleFindAuthorization)
+	// 风控规则和命中记录（审计用）
+	mux.HandleFunc("/credit-card-authorizer/risk/rules", h.handleRiskRules)
+	mux.HandleFunc("/credit-card-authorizer/risk/hits", h.handleRiskHits)
+	// 模拟客户账户：额度和余额（测试场景用的管理接口）
+	mux.HandleFunc("/credit-card-authorizer/accounts", h.handleListAccounts)
+	mux.HandleFunc("/credit-card-authorizer/accounts/", h.handleAccount)
 
 	// （可选）给你自己 curl 用的短路径，不影响 YAML 一致性
 	mux.HandleFunc("/authorize", h.handleAuthorize)
+	mux.HandleFunc("/tokenize", h.handleTokenize)
+	mux.HandleFunc("/authorizations/", h.handleAuthorizationOperations)
+	mux.HandleFunc("/authorizations", h.handleFindAuthorization)
 }
 
 func (h *Handler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
@@ -40,6 +121,12 @@ func (h *Handler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 
 	var payload struct {
 		CreditCardNumber string `json:"credit_card_number"`
+		CardToken        string `json:"card_token,omitempty"`
+		Expiry           string `json:"expiry,omitempty"`
+		CVV              string `json:"cvv,omitempty"`
+		Amount           int64  `json:"amount"`
+		Currency         string `json:"currency,omitempty"`
+		CustomerID       int    `json:"customer_id,omitempty"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
@@ -47,19 +134,98 @@ func (h *Handler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 校验格式：4 组 4 位数字，用短横线分隔
-	validFormat := regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{4}$`)
-	if !validFormat.MatchString(payload.CreditCardNumber) {
+	// 同一个 Idempotency-Key 已经授权过：直接返回那笔授权，不再占额度
+	key := r.Header.Get(IdempotencyKeyHeader)
+	if auth, err := h.store.FindByIdempotencyKey(key); err == nil {
+		writeJSON(w, http.StatusOK, auth)
+		return
+	}
+
+	// credit_card_number 和 card_token 二选一；token 换回卡号和保存的有效期
+	if payload.CardToken != "" {
+		if payload.CreditCardNumber != "" {
+			h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Provide either credit_card_number or card_token, not both")
+			return
+		}
+		card, err := h.vault.Detokenize(payload.CardToken)
+		if err != nil {
+			h.writeError(w, http.StatusBadRequest, "INVALID_TOKEN", "Unknown card token")
+			return
+		}
+		payload.CreditCardNumber = card.PAN
+		if payload.Expiry == "" {
+			payload.Expiry = card.Expiry
+		}
+	}
+
+	// 金额以最小货币单位（分）表示，必须为正数且不超过 maxAmount
+	if payload.Amount <= 0 || payload.Amount > maxAmount {
+		h.writeError(w, http.StatusBadRequest, "INVALID_AMOUNT", fmt.Sprintf("amount must be between 1 and %d", maxAmount))
+		return
+	}
+	if payload.Currency == "" {
+		payload.Currency = "USD"
+	}
+	if !currencyFormat.MatchString(payload.Currency) {
+		h.writeError(w, http.StatusBadRequest, "INVALID_CURRENCY", "currency must be a 3-letter ISO 4217 code")
+		return
+	}
+
+	// 校验卡号（Luhn、卡组织、长度）以及可选的有效期和 CVV
+	brand, err := validateCard(payload.CreditCardNumber, payload.Expiry, payload.CVV, time.Now())
+	if err != nil {
 		// ✅ YAML: 400 Invalid payment information
-		h.writeError(w, http.StatusBadRequest, "INVALID_FORMAT", "Credit card number must be in format: 1234-5678-9012-3456")
+		var ce *cardError
+		if errors.As(err, &ce) {
+			h.writeError(w, http.StatusBadRequest, ce.code, ce.message)
+			return
+		}
+		h.writeError(w, http.StatusBadRequest, "INVALID_FORMAT", err.Error())
 		return
 	}
 
-	// 90% 授权，10% 拒绝
-	authorized := h.rng.Float32() < 0.9
+	digits := normalizeCardNumber(payload.CreditCardNumber)
+
+	// 风控规则先于授权执行；命中即拒绝，并带上原因码
+	decision := h.risk.Evaluate(risk.Request{
+		CardNumber: digits,
+		CustomerID: payload.CustomerID,
+		Amount:     payload.Amount,
+	})
+	if !decision.Allowed {
+		recordDecline(decision.Code)
+		h.writeError(w, http.StatusPaymentRequired, decision.Code, decision.Message)
+		return
+	}
+
+	// 测试卡号返回固定结果；其他卡号按 approvalRate 随机授权
+	authorized := false
+	switch testCards[digits] {
+	case outcomeApprove:
+		authorized = true
+	case outcomeDecline:
+		authorized = false
+	case outcomeInvalid:
+		h.writeError(w, http.StatusBadRequest, "INVALID_CARD", "Test card rejected as invalid")
+		return
+	case outcomeError:
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Test card triggered a server error")
+		return
+	case outcomeTimeout:
+		// 挂起直到调用方放弃（或 timeoutDelay 到期）
+		select {
+		case <-r.Context().Done():
+		case <-time.After(h.timeoutDelay):
+			h.writeError(w, http.StatusGatewayTimeout, "TIMEOUT", "Test card timed out")
+		}
+		return
+	default:
+		authorized = h.approve()
+	}
 
 	if !authorized {
 		// ✅ YAML: 402 Payment declined
+		recordDecline("PAYMENT_DECLINED")
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusPaymentRequired)
 		_ = json.NewEncoder(w).Encode(ErrorResponse{
@@ -69,17 +235,62 @@ func (h *Handler) handleAuthorize(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ✅ YAML: 200 Payment authorized successfully
-	// Body YAML 没规定，你可以随意；这里给个简单 JSON
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(map[string]string{
-		"status": "Authorized",
+	// 占用客户额度；超出额度按拒绝处理
+	if payload.CustomerID > 0 {
+		if err := h.accounts.Reserve(payload.CustomerID, payload.Amount); err != nil {
+			recordDecline("INSUFFICIENT_FUNDS")
+			h.writeError(w, http.StatusPaymentRequired, "INSUFFICIENT_FUNDS", "Amount exceeds the customer's available credit")
+			return
+		}
+	}
+
+	// 授权通过：记录一笔 hold，之后可以 capture / void / refund
+	auth, created := h.store.CreateAuthorization(models.Authorization{
+		AuthorizationID: newAuthorizationID(),
+		Brand:           string(brand),
+		CardLast4:       digits[len(digits)-4:],
+		CustomerID:      payload.CustomerID,
+		IdempotencyKey:  key,
+		Amount:          payload.Amount,
+		Currency:        payload.Currency,
 	})
+	if !created {
+		// 同一个 key 的并发请求先建好了授权：还回这次占的额度，返回那一笔
+		if payload.CustomerID > 0 {
+			h.accounts.Release(payload.CustomerID, payload.Amount)
+		}
+		writeJSON(w, http.StatusOK, auth)
+		return
+	}
+
+	authorizationsTotal.Inc("approved")
+
+	// ✅ YAML: 200 Payment authorized successfully
+	// Body YAML 没规定，你可以随意；这里返回授权记录，供下游订单引用
+	writeJSON(w, http.StatusOK, auth)
+}
+
+// newAuthorizationID returns a random reference for an approved authorization.
+func newAuthorizationID() string {
+	var b [12]byte
+	_, _ = crand.Read(b[:])
+	return "auth_" + hex.EncodeToString(b[:])
+}
+
+// approve 以 approvalRate 的概率返回 true。
+func (h *Handler) approve() bool {
+	h.rngMu.Lock()
+	defer h.rngMu.Unlock()
+	return h.rng.Float64() < h.approvalRate
 }
 
 func (h *Handler) writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, ErrorResponse{Error: code, Message: message})
+}
+
+// writeJSON writes a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
-	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: code, Message: message})
-}
\ No newline at end of file
+	_ = json.NewEncoder(w).Encode(data)
+}
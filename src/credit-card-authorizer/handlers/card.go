@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Brand is a supported card network.
+type Brand string
+
+const (
+	BrandVisa       Brand = "visa"
+	BrandMastercard Brand = "mastercard"
+	BrandAmex       Brand = "amex"
+)
+
+var (
+	expiryFormat = regexp.MustCompile(`^(0[1-9]|1[0-2])/(\d{2})$`)
+	cvvFormat    = regexp.MustCompile(`^\d{3,4}$`)
+)
+
+// cardError is a validation failure carrying the error code returned to clients.
+type cardError struct {
+	code    string
+	message string
+}
+
+func (e *cardError) Error() string { return e.message }
+
+// validateCard checks the card number (separators '-' and ' ' are allowed),
+// detects its brand, and validates the optional expiry (MM/YY) and CVV.
+func validateCard(number, expiry, cvv string, now time.Time) (Brand, error) {
+	digits := normalizeCardNumber(number)
+	if digits == "" {
+		return "", &cardError{"INVALID_FORMAT", "Credit card number must contain only digits, spaces or dashes"}
+	}
+
+	brand := detectBrand(digits)
+	if brand == "" {
+		return "", &cardError{"UNSUPPORTED_BRAND", "Only Visa, Mastercard and Amex cards are supported"}
+	}
+	if !validLength(brand, len(digits)) {
+		return "", &cardError{"INVALID_FORMAT", "Credit card number has the wrong length for " + string(brand)}
+	}
+
+	if !luhnValid(digits) {
+		return "", &cardError{"INVALID_CHECKSUM", "Credit card number failed checksum validation"}
+	}
+
+	if expiry != "" {
+		m := expiryFormat.FindStringSubmatch(expiry)
+		if m == nil {
+			return "", &cardError{"INVALID_EXPIRY", "Expiry must be in format: MM/YY"}
+		}
+		month, _ := strconv.Atoi(m[1])
+		year, _ := strconv.Atoi(m[2])
+		// Cards are valid through the last day of the expiry month.
+		expiresAt := time.Date(2000+year, time.Month(month)+1, 1, 0, 0, 0, 0, time.UTC)
+		if !now.Before(expiresAt) {
+			return "", &cardError{"CARD_EXPIRED", "Credit card has expired"}
+		}
+	}
+
+	if cvv != "" {
+		wantLen := 3
+		if brand == BrandAmex {
+			wantLen = 4
+		}
+		if !cvvFormat.MatchString(cvv) || len(cvv) != wantLen {
+			return "", &cardError{"INVALID_CVV", "CVV must be " + strconv.Itoa(wantLen) + " digits for " + string(brand)}
+		}
+	}
+
+	return brand, nil
+}
+
+// normalizeCardNumber strips '-' and ' ' separators. It returns "" if any
+// other non-digit character is present.
+func normalizeCardNumber(number string) string {
+	var b strings.Builder
+	for _, r := range number {
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case r == '-' || r == ' ':
+		default:
+			return ""
+		}
+	}
+	return b.String()
+}
+
+// detectBrand identifies the card network from its IIN prefix.
+func detectBrand(digits string) Brand {
+	if len(digits) < 4 {
+		return ""
+	}
+	prefix2, _ := strconv.Atoi(digits[:2])
+	prefix4, _ := strconv.Atoi(digits[:4])
+
+	switch {
+	case digits[0] == '4':
+		return BrandVisa
+	case prefix2 >= 51 && prefix2 <= 55, prefix4 >= 2221 && prefix4 <= 2720:
+		return BrandMastercard
+	case prefix2 == 34 || prefix2 == 37:
+		return BrandAmex
+	}
+	return ""
+}
+
+// validLength reports whether n is a valid card number length for the brand.
+func validLength(brand Brand, n int) bool {
+	switch brand {
+	case BrandVisa:
+		return n == 13 || n == 16 || n == 19
+	case BrandMastercard:
+		return n == 16
+	case BrandAmex:
+		return n == 15
+	}
+	return false
+}
+
+// luhnValid reports whether digits passes the Luhn checksum.
+func luhnValid(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
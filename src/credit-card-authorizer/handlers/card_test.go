@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLuhnValid(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{"4242424242424242", true},
+		{"4242424242424241", false},
+		{"378282246310005", true},
+		{"378282246310006", false},
+		{"5555555555554444", true},
+		{"4111111111111111110", true},
+		{"4111111111111111111", false},
+		{"0", true},
+		{"18", true},
+		{"19", false},
+	}
+	for _, tt := range tests {
+		if got := luhnValid(tt.digits); got != tt.want {
+			t.Errorf("luhnValid(%s) = %v, want %v", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestDetectBrand(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   Brand
+	}{
+		{"4242424242424242", BrandVisa},
+		{"4222222222222", BrandVisa},
+		{"5105105105105100", BrandMastercard},
+		{"5555555555554444", BrandMastercard},
+		{"2221000000000009", BrandMastercard},
+		{"2720990000000000", BrandMastercard},
+		{"2220990000000000", ""},
+		{"2721000000000000", ""},
+		{"5655555555554444", ""},
+		{"340000000000009", BrandAmex},
+		{"378282246310005", BrandAmex},
+		{"6011111111111117", ""},
+		{"424", ""},
+	}
+	for _, tt := range tests {
+		if got := detectBrand(tt.digits); got != tt.want {
+			t.Errorf("detectBrand(%s) = %q, want %q", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestValidateCard(t *testing.T) {
+	// 固定当前时间，过期判断不随运行日期变化
+	now := time.Date(2025, time.June, 15, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		number string
+		expiry string
+		cvv    string
+		brand  Brand
+		code   string
+	}{
+		{name: "visa", number: "4242424242424242", brand: BrandVisa},
+		{name: "visa 13 digits", number: "4222222222222", brand: BrandVisa},
+		{name: "visa 19 digits", number: "4111111111111111110", brand: BrandVisa},
+		{name: "mastercard 2-series", number: "2223003122003222", brand: BrandMastercard},
+		{name: "amex", number: "378282246310005", brand: BrandAmex},
+		{name: "spaces", number: "4242 4242 4242 4242", brand: BrandVisa},
+		{name: "dashes", number: "4242-4242-4242-4242", brand: BrandVisa},
+		{name: "amex grouping", number: "3782 822463 10005", brand: BrandAmex},
+		{name: "19 digits with spaces", number: "4111 1111 1111 1111 110", brand: BrandVisa},
+
+		{name: "letters", number: "4242-4242-4242-424x", code: "INVALID_FORMAT"},
+		{name: "only separators", number: "- -", code: "INVALID_FORMAT"},
+		{name: "empty", number: "", code: "INVALID_FORMAT"},
+		{name: "unsupported brand", number: "6011111111111117", code: "UNSUPPORTED_BRAND"},
+		{name: "visa 15 digits", number: "424242424242424", code: "INVALID_FORMAT"},
+		{name: "visa 20 digits", number: "41111111111111111103", code: "INVALID_FORMAT"},
+		{name: "mastercard 19 digits", number: "5555555555554444000", code: "INVALID_FORMAT"},
+		{name: "amex 16 digits", number: "3782822463100051", code: "INVALID_FORMAT"},
+		{name: "bad checksum", number: "4242424242424241", code: "INVALID_CHECKSUM"},
+		{name: "bad checksum 19 digits", number: "4111111111111111111", code: "INVALID_CHECKSUM"},
+
+		{name: "expires this month", number: "4242424242424242", expiry: "06/25", brand: BrandVisa},
+		{name: "expired last month", number: "4242424242424242", expiry: "05/25", code: "CARD_EXPIRED"},
+		{name: "december", number: "4242424242424242", expiry: "12/25", brand: BrandVisa},
+		{name: "next year", number: "4242424242424242", expiry: "01/26", brand: BrandVisa},
+		{name: "last year", number: "4242424242424242", expiry: "12/24", code: "CARD_EXPIRED"},
+		{name: "month 13", number: "4242424242424242", expiry: "13/25", code: "INVALID_EXPIRY"},
+		{name: "month 00", number: "4242424242424242", expiry: "00/25", code: "INVALID_EXPIRY"},
+		{name: "four-digit year", number: "4242424242424242", expiry: "12/2025", code: "INVALID_EXPIRY"},
+		{name: "no slash", number: "4242424242424242", expiry: "1225", code: "INVALID_EXPIRY"},
+
+		{name: "visa cvv", number: "4242424242424242", cvv: "123", brand: BrandVisa},
+		{name: "visa 4-digit cvv", number: "4242424242424242", cvv: "1234", code: "INVALID_CVV"},
+		{name: "mastercard cvv", number: "5555555555554444", cvv: "999", brand: BrandMastercard},
+		{name: "mastercard 2-digit cvv", number: "5555555555554444", cvv: "12", code: "INVALID_CVV"},
+		{name: "amex cvv", number: "378282246310005", cvv: "1234", brand: BrandAmex},
+		{name: "amex 3-digit cvv", number: "378282246310005", cvv: "123", code: "INVALID_CVV"},
+		{name: "cvv letters", number: "4242424242424242", cvv: "12a", code: "INVALID_CVV"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brand, err := validateCard(tt.number, tt.expiry, tt.cvv, now)
+			if tt.code == "" {
+				if err != nil || brand != tt.brand {
+					t.Fatalf("validateCard = %q, %v; want %q", brand, err, tt.brand)
+				}
+				return
+			}
+			var cerr *cardError
+			if !errors.As(err, &cerr) || cerr.code != tt.code {
+				t.Fatalf("validateCard = %q, %v; want %s", brand, err, tt.code)
+			}
+		})
+	}
+}
+
+// TestValidateCardYearRollover 确认 12 月到期的卡在次年 1 月 1 日才过期。
+func TestValidateCardYearRollover(t *testing.T) {
+	for _, tt := range []struct {
+		now     time.Time
+		expired bool
+	}{
+		{time.Date(2025, time.December, 31, 23, 59, 59, 0, time.UTC), false},
+		{time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC), true},
+	} {
+		_, err := validateCard("4242424242424242", "12/25", "", tt.now)
+		if got := err != nil; got != tt.expired {
+			t.Errorf("12/25 at %s: err = %v, want expired %v", tt.now, err, tt.expired)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"credit-card-authorizer/risk"
+)
+
+// handleRiskRules returns the risk rules currently in effect. Denied card
+// numbers are reduced to their last four digits.
+func (h *Handler) handleRiskRules(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.risk.Config().Redacted())
+}
+
+// handleRiskHits returns recorded rule hits, newest first.
+// Optional query parameters: code, card_last4, customer_id, limit.
+func (h *Handler) handleRiskHits(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	filter := risk.HitFilter{
+		Code:      q.Get("code"),
+		CardLast4: q.Get("card_last4"),
+		Limit:     100,
+	}
+	if v := q.Get("customer_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id < 1 {
+			h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "customer_id must be a positive integer")
+			return
+		}
+		filter.CustomerID = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "limit must be a positive integer")
+			return
+		}
+		filter.Limit = n
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"hits": h.risk.Hits(filter),
+	})
+}
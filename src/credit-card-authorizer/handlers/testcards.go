@@ -0,0 +1,24 @@
+package handlers
+
+// testOutcome is the fixed result for a well-known test card number.
+type testOutcome int
+
+const (
+	outcomeApprove testOutcome = iota + 1
+	outcomeDecline
+	outcomeInvalid
+	outcomeTimeout
+	outcomeError
+)
+
+// testCards maps card numbers (digits only) to a fixed outcome so that
+// integration tests can assert on checkout results. All of them are
+// Luhn-valid Visa numbers and still go through expiry/CVV validation.
+// Any other number is approved at the configured approval rate.
+var testCards = map[string]testOutcome{
+	"4242424242424242": outcomeApprove, // 200 Authorized
+	"4000000000000002": outcomeDecline, // 402 PAYMENT_DECLINED
+	"4000000000000127": outcomeInvalid, // 400 INVALID_CARD
+	"4000000000000036": outcomeTimeout, // no response until the client gives up
+	"4000000000000119": outcomeError,   // 500 INTERNAL_ERROR
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"credit-card-authorizer/risk"
+	"credit-card-authorizer/storage"
+)
+
+// testHandler 返回一个只用内存存储的 handler。approvalRate 为 0，
+// 不在 testCards 里的卡号一律拒绝，结果是确定的。
+func testHandler(timeoutDelay time.Duration) (*Handler, *http.ServeMux) {
+	h := NewHandler(storage.NewMemoryStore(), storage.NewTokenVault(), storage.NewAccountStore(0),
+		risk.NewEngine(risk.Config{}), 0, timeoutDelay)
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return h, mux
+}
+
+func authorize(ctx context.Context, mux http.Handler, card string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"credit_card_number":%q,"expiry":"12/99","cvv":"123","amount":1000}`, card)
+	req := httptest.NewRequest(http.MethodPost, "/credit-card-authorizer/authorize", strings.NewReader(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestTestCards(t *testing.T) {
+	_, mux := testHandler(10 * time.Millisecond)
+
+	tests := []struct {
+		card   string
+		status int
+		code   string
+	}{
+		{"4242424242424242", http.StatusOK, ""},
+		{"4242-4242-4242-4242", http.StatusOK, ""},
+		{"4000000000000002", http.StatusPaymentRequired, "PAYMENT_DECLINED"},
+		{"4000000000000127", http.StatusBadRequest, "INVALID_CARD"},
+		{"4000000000000119", http.StatusInternalServerError, "INTERNAL_ERROR"},
+		// 调用方一直等着的话，timeoutDelay 到期后返回 504
+		{"4000000000000036", http.StatusGatewayTimeout, "TIMEOUT"},
+		// 其他卡号按 approvalRate（这里是 0）
+		{"5555555555554444", http.StatusPaymentRequired, "PAYMENT_DECLINED"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.card, func(t *testing.T) {
+			rec := authorize(context.Background(), mux, tt.card)
+			var body struct {
+				AuthorizationID string `json:"authorization_id"`
+				Status          string `json:"status"`
+				Error           string `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatalf("response %q: %v", rec.Body, err)
+			}
+			if rec.Code != tt.status || body.Error != tt.code {
+				t.Fatalf("got %d %s, want %d %s", rec.Code, body.Error, tt.status, tt.code)
+			}
+			if tt.status == http.StatusOK && (body.AuthorizationID == "" || body.Status != "authorized") {
+				t.Errorf("approved card returned %+v, want an authorized hold", body)
+			}
+		})
+	}
+}
+
+// TestTimeoutCardHangs 确认超时测试卡在调用方放弃之前不返回任何响应。
+func TestTimeoutCardHangs(t *testing.T) {
+	_, mux := testHandler(time.Hour)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rec := authorize(ctx, mux, "4000000000000036")
+
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("handler returned after %s, want when the client gave up (20ms)", elapsed)
+	}
+	if rec.Body.Len() != 0 {
+		t.Errorf("timeout card wrote %q, want no response", rec.Body)
+	}
+}
+
+// TestTestCardsPlaceNoHold 确认被拒绝或出错的测试卡不占客户额度。
+func TestTestCardsPlaceNoHold(t *testing.T) {
+	h, mux := testHandler(time.Millisecond)
+	h.accounts.PutAccount(7, 1000, 0)
+
+	for _, card := range []string{"4000000000000002", "4000000000000127", "4000000000000119", "4000000000000036"} {
+		body := fmt.Sprintf(`{"credit_card_number":%q,"amount":1000,"customer_id":7}`, card)
+		req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(body))
+		mux.ServeHTTP(httptest.NewRecorder(), req)
+	}
+	if acct, _ := h.accounts.GetAccount(7); acct.Balance != 0 {
+		t.Fatalf("balance %d after failed test cards, want 0", acct.Balance)
+	}
+
+	rec := authorize(context.Background(), mux, "4242424242424242")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("approve card = %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	crand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"credit-card-authorizer/models"
+)
+
+// handleTokenize exchanges a card number for an opaque token that can be
+// used as card_token on authorize instead of credit_card_number.
+func (h *Handler) handleTokenize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var payload struct {
+		CreditCardNumber string `json:"credit_card_number"`
+		Expiry           string `json:"expiry,omitempty"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
+		return
+	}
+
+	// 只对有效卡号发 token
+	brand, err := validateCard(payload.CreditCardNumber, payload.Expiry, "", time.Now())
+	if err != nil {
+		var ce *cardError
+		if errors.As(err, &ce) {
+			h.writeError(w, http.StatusBadRequest, ce.code, ce.message)
+			return
+		}
+		h.writeError(w, http.StatusBadRequest, "INVALID_FORMAT", err.Error())
+		return
+	}
+
+	digits := normalizeCardNumber(payload.CreditCardNumber)
+	card := h.vault.Tokenize(models.CardToken{
+		Token:     newCardToken(),
+		Brand:     string(brand),
+		CardLast4: digits[len(digits)-4:],
+		PAN:       digits,
+		Expiry:    payload.Expiry,
+	})
+
+	writeJSON(w, http.StatusOK, card)
+}
+
+// newCardToken returns a random opaque card token.
+func newCardToken() string {
+	var b [16]byte
+	_, _ = crand.Read(b[:])
+	return "tok_" + hex.EncodeToString(b[:])
+}
@@ -1,23 +1,178 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"common/metrics"
+	"common/redact"
+	"common/routes"
+	"common/tracing"
 
 	"credit-card-authorizer/handlers"
+	"credit-card-authorizer/risk"
+	"credit-card-authorizer/storage"
 )
 
 func main() {
+	// Mask card numbers in every log line
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	// Export spans (OTEL_EXPORTER_OTLP_ENDPOINT or TRACE_FILE)
+	stopTracing, err := tracing.Init("credit-card-authorizer")
+	if err != nil {
+		log.Fatalf("failed to start tracing: %v", err)
+	}
+
+	// Create storage
+	store := storage.NewMemoryStore()
+	vault := storage.NewTokenVault()
+
+	// Voided, refunded and expired authorizations are dropped after
+	// CCA_AUTHORIZATION_TTL (default 24h) so the in-memory store does not grow
+	// without bound
+	authorizationTTL := 24 * time.Hour
+	if val := os.Getenv("CCA_AUTHORIZATION_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			authorizationTTL = d
+		} else {
+			log.Printf("Ignoring invalid CCA_AUTHORIZATION_TTL %q", val)
+		}
+	}
+
+	// Holds neither captured nor voided expire after CCA_HOLD_TTL (default
+	// 7 days) and give their credit back, like a card issuer's hold would
+	holdTTL := 7 * 24 * time.Hour
+	if val := os.Getenv("CCA_HOLD_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			holdTTL = d
+		} else {
+			log.Printf("Ignoring invalid CCA_HOLD_TTL %q", val)
+		}
+	}
+
+	// Captured authorizations can be refunded until they are dropped after
+	// CCA_CAPTURED_TTL (default 30 days)
+	capturedTTL := 30 * 24 * time.Hour
+	if val := os.Getenv("CCA_CAPTURED_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			capturedTTL = d
+		} else {
+			log.Printf("Ignoring invalid CCA_CAPTURED_TTL %q", val)
+		}
+	}
+	sweepCtx, stopSweeping := context.WithCancel(context.Background())
+	defer stopSweeping()
+
+	// Card tokens (and the card numbers behind them) are dropped once unused
+	// for CCA_TOKEN_TTL (default 24h)
+	tokenTTL := 24 * time.Hour
+	if val := os.Getenv("CCA_TOKEN_TTL"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			tokenTTL = d
+		} else {
+			log.Printf("Ignoring invalid CCA_TOKEN_TTL %q", val)
+		}
+	}
+	go vault.Sweep(sweepCtx, tokenTTL, time.Minute)
+
+	// Credit limit given to customers without a seeded account (0 = unlimited)
+	var defaultCreditLimit int64
+	if val := os.Getenv("CCA_DEFAULT_CREDIT_LIMIT"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			defaultCreditLimit = n
+		} else {
+			log.Printf("Ignoring invalid CCA_DEFAULT_CREDIT_LIMIT %q", val)
+		}
+	}
+	accounts := storage.NewAccountStore(defaultCreditLimit)
+
+	// Approval rate for non-test cards (default 90%)
+	approvalRate := 0.9
+	if val := os.Getenv("CCA_APPROVAL_RATE"); val != "" {
+		if rate, err := strconv.ParseFloat(val, 64); err == nil && rate >= 0 && rate <= 1 {
+			approvalRate = rate
+		} else {
+			log.Printf("Ignoring invalid CCA_APPROVAL_RATE %q", val)
+		}
+	}
+
+	// How long the timeout test card hangs before giving up
+	timeoutDelay := 30 * time.Second
+	if val := os.Getenv("CCA_TIMEOUT_DELAY"); val != "" {
+		if d, err := time.ParseDuration(val); err == nil && d > 0 {
+			timeoutDelay = d
+		} else {
+			log.Printf("Ignoring invalid CCA_TIMEOUT_DELAY %q", val)
+		}
+	}
+
+	// Risk rules are optional; the file is polled and hot-reloaded on change
+	riskEngine := risk.NewEngine(risk.Config{})
+	if path := os.Getenv("CCA_RISK_RULES"); path != "" {
+		cfg, err := risk.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("failed to load risk rules: %v", err)
+		}
+		riskEngine.SetConfig(cfg)
+		log.Printf("Loaded risk rules from %s", path)
+
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		go riskEngine.WatchFile(watchCtx, path, 5*time.Second)
+	}
+
 	// Create handler
-	handler := handlers.NewHandler()
+	handler := handlers.NewHandler(store, vault, accounts, riskEngine, approvalRate, timeoutDelay)
+
+	// Expired holds release their credit through the handler
+	go store.Sweep(sweepCtx, storage.SweepPolicy{
+		HoldTTL:     holdTTL,
+		CapturedTTL: capturedTTL,
+		FinishedTTL: authorizationTTL,
+		OnExpire:    handler.ReleaseExpiredHold,
+	}, time.Minute)
 
 	// Create mux
 	mux := http.NewServeMux()
 
-	// Register routes
+	// Register routes; Prometheus metrics are served at /metrics
 	handler.RegisterRoutes(mux)
+	mux.Handle("/metrics", metrics.Handler())
+
+	// Start server, counting and timing every request by route and status
+	// and continuing the caller's trace
+	names := routes.New(mux, handlers.Routes...)
+	srv := &http.Server{Addr: ":8082", Handler: tracing.Middleware(metrics.Instrument(mux, names), names)}
+
+	go func() {
+		log.Println("Starting credit card authorizer service on :8082")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then stop accepting connections and let
+	// in-flight requests finish before exiting.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
 
-	// Start server
-	log.Println("Starting credit card authorizer service on :8082")
-	log.Fatal(http.ListenAndServe(":8082", mux))
+	log.Println("Shutting down credit card authorizer...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("graceful shutdown failed: %v", err)
+	}
+	if err := stopTracing(ctx); err != nil {
+		log.Printf("flushing traces failed: %v", err)
+	}
+	log.Println("Credit card authorizer stopped")
 }
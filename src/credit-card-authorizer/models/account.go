@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Account is a simulated customer credit account. Amounts are in minor
+// units; currencies are not converted.
+//
+// Balance is everything currently held or captured against the account.
+// An authorization is declined when Balance + amount would exceed
+// CreditLimit.
+type Account struct {
+	CustomerID  int       `json:"customer_id"`
+	CreditLimit int64     `json:"credit_limit"`
+	Balance     int64     `json:"balance"`
+	Available   int64     `json:"available"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
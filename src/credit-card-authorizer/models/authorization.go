@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Status is the lifecycle state of an authorization.
+//
+//	authorized → captured → refunded
+//	authorized → voided
+//	authorized → expired
+type Status string
+
+const (
+	StatusAuthorized Status = "authorized"
+	StatusCaptured   Status = "captured"
+	StatusVoided     Status = "voided"
+	StatusRefunded   Status = "refunded"
+	StatusExpired    Status = "expired"
+)
+
+// Authorization is a hold placed on a card for an amount, in minor units
+// (e.g. cents) of Currency.
+type Authorization struct {
+	AuthorizationID string    `json:"authorization_id"`
+	Status          Status    `json:"status"`
+	Brand           string    `json:"brand"`
+	CardLast4       string    `json:"card_last4"`
+	CustomerID      int       `json:"customer_id,omitempty"`
+	IdempotencyKey  string    `json:"idempotency_key,omitempty"`
+	Amount          int64     `json:"amount"`
+	Currency        string    `json:"currency"`
+	CapturedAmount  int64     `json:"captured_amount"`
+	RefundedAmount  int64     `json:"refunded_amount"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
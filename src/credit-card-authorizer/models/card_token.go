@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// CardToken is an opaque stand-in for a card number. The PAN and expiry
+// stay inside the authorizer and are never serialized.
+type CardToken struct {
+	Token     string    `json:"card_token"`
+	Brand     string    `json:"brand"`
+	CardLast4 string    `json:"card_last4"`
+	CreatedAt time.Time `json:"created_at"`
+
+	PAN    string `json:"-"`
+	Expiry string `json:"-"`
+}
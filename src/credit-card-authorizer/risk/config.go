@@ -0,0 +1,132 @@
+package risk
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the rule set loaded from the risk rules file. A zero value
+// disables every rule.
+//
+// Example:
+//
+//	{
+//	  "max_amount": 500000,
+//	  "blocked_bins": ["555555"],
+//	  "denied_cards": ["4000-0000-0000-0010"],
+//	  "velocity": {
+//	    "per_card":     {"max": 5,  "window": "1m"},
+//	    "per_customer": {"max": 20, "window": "1m"}
+//	  }
+//	}
+type Config struct {
+	// MaxAmount declines authorizations above this amount (minor units). 0 disables.
+	MaxAmount int64 `json:"max_amount"`
+
+	// BlockedBINs declines cards starting with any of these prefixes.
+	BlockedBINs []string `json:"blocked_bins"`
+
+	// DeniedCards declines these exact card numbers.
+	DeniedCards []string `json:"denied_cards"`
+
+	Velocity struct {
+		PerCard     VelocityLimit `json:"per_card"`
+		PerCustomer VelocityLimit `json:"per_customer"`
+	} `json:"velocity"`
+}
+
+// VelocityLimit allows at most Max attempts within Window. Max 0 disables.
+type VelocityLimit struct {
+	Max    int      `json:"max"`
+	Window Duration `json:"window"`
+}
+
+// Duration is a time.Duration written as a string ("30s", "5m") in JSON.
+type Duration time.Duration
+
+// UnmarshalJSON parses a time.ParseDuration string.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// LoadConfig reads and validates a rules file. Card numbers and BINs may
+// contain dashes or spaces; they are normalized to digits.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("invalid risk rules file: %w", err)
+	}
+	if err := cfg.normalize(); err != nil {
+		return Config{}, fmt.Errorf("invalid risk rules file: %w", err)
+	}
+	return cfg, nil
+}
+
+// Redacted returns a copy of the config with denied card numbers reduced to
+// their last four digits, safe to return from the audit API.
+func (c Config) Redacted() Config {
+	denied := make([]string, len(c.DeniedCards))
+	for i, card := range c.DeniedCards {
+		denied[i] = last4(card)
+	}
+	c.DeniedCards = denied
+	return c
+}
+
+func (c *Config) normalize() error {
+	if c.MaxAmount < 0 {
+		return errors.New("max_amount must be non-negative")
+	}
+	for _, v := range []VelocityLimit{c.Velocity.PerCard, c.Velocity.PerCustomer} {
+		if v.Max < 0 {
+			return errors.New("velocity max must be non-negative")
+		}
+		if v.Max > 0 && v.Window <= 0 {
+			return errors.New("velocity window must be positive when max is set")
+		}
+	}
+
+	var err error
+	if c.BlockedBINs, err = digitsOnly(c.BlockedBINs); err != nil {
+		return fmt.Errorf("blocked_bins: %w", err)
+	}
+	if c.DeniedCards, err = digitsOnly(c.DeniedCards); err != nil {
+		return fmt.Errorf("denied_cards: %w", err)
+	}
+	return nil
+}
+
+func digitsOnly(values []string) ([]string, error) {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		d := strings.NewReplacer("-", "", " ", "").Replace(v)
+		if d == "" || strings.Trim(d, "0123456789") != "" {
+			return nil, fmt.Errorf("%q is not a number", v)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
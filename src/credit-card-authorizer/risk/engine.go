@@ -0,0 +1,272 @@
+// Package risk evaluates fraud and risk rules before a card is authorized.
+package risk
+
+import (
+	"context"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decline reason codes returned to clients.
+const (
+	CodeCardDenylisted        = "CARD_DENYLISTED"
+	CodeBINBlocked            = "BIN_BLOCKED"
+	CodeAmountLimitExceeded   = "AMOUNT_LIMIT_EXCEEDED"
+	CodeVelocityCardLimit     = "VELOCITY_LIMIT_CARD"
+	CodeVelocityCustomerLimit = "VELOCITY_LIMIT_CUSTOMER"
+)
+
+// auditCapacity bounds the number of rule hits kept in memory.
+const auditCapacity = 1000
+
+// pruneInterval is how often cards and customers with no attempts left in
+// their velocity window are dropped.
+const pruneInterval = time.Minute
+
+// Request is the input to rule evaluation.
+type Request struct {
+	CardNumber string // digits only
+	CustomerID int    // 0 if unknown
+	Amount     int64
+}
+
+// Decision is the outcome of rule evaluation. Code and Message are set
+// when Allowed is false.
+type Decision struct {
+	Allowed bool
+	Code    string
+	Message string
+}
+
+// Hit records a rule that declined an authorization. Only the last four
+// digits of the card are kept.
+type Hit struct {
+	Time       time.Time `json:"time"`
+	Code       string    `json:"code"`
+	Message    string    `json:"message"`
+	CardLast4  string    `json:"card_last4"`
+	CustomerID int       `json:"customer_id,omitempty"`
+	Amount     int64     `json:"amount"`
+}
+
+// HitFilter selects audit entries. Zero fields match everything.
+type HitFilter struct {
+	Code       string
+	CardLast4  string
+	CustomerID int
+	Limit      int
+}
+
+// Engine evaluates the current Config. It is safe for concurrent use, and
+// the config can be swapped at any time with SetConfig or WatchFile.
+type Engine struct {
+	cfgMu sync.RWMutex
+	cfg   Config
+
+	velocityMu   sync.Mutex
+	cardHits     map[string][]time.Time
+	customerHits map[int][]time.Time
+	lastPrune    time.Time
+
+	auditMu sync.Mutex
+	audit   []Hit
+}
+
+// NewEngine creates an engine with the given rules.
+func NewEngine(cfg Config) *Engine {
+	return &Engine{
+		cfg:          cfg,
+		cardHits:     make(map[string][]time.Time),
+		customerHits: make(map[int][]time.Time),
+	}
+}
+
+// Config returns the rules currently in effect.
+func (e *Engine) Config() Config {
+	e.cfgMu.RLock()
+	defer e.cfgMu.RUnlock()
+	return e.cfg
+}
+
+// SetConfig replaces the rules in effect.
+func (e *Engine) SetConfig(cfg Config) {
+	e.cfgMu.Lock()
+	defer e.cfgMu.Unlock()
+	e.cfg = cfg
+}
+
+// Evaluate applies the rules in order: denylist, blocked BINs, amount
+// threshold, per-card velocity, per-customer velocity. Every evaluated
+// request counts towards the velocity windows. Declines are recorded in
+// the audit log.
+func (e *Engine) Evaluate(req Request) Decision {
+	cfg := e.Config()
+	now := time.Now()
+
+	d := e.evaluate(cfg, req, now)
+	if !d.Allowed {
+		e.record(Hit{
+			Time:       now.UTC(),
+			Code:       d.Code,
+			Message:    d.Message,
+			CardLast4:  last4(req.CardNumber),
+			CustomerID: req.CustomerID,
+			Amount:     req.Amount,
+		})
+	}
+	return d
+}
+
+func (e *Engine) evaluate(cfg Config, req Request, now time.Time) Decision {
+	for _, card := range cfg.DeniedCards {
+		if req.CardNumber == card {
+			return Decision{Code: CodeCardDenylisted, Message: "Card is denylisted"}
+		}
+	}
+
+	for _, bin := range cfg.BlockedBINs {
+		if strings.HasPrefix(req.CardNumber, bin) {
+			return Decision{Code: CodeBINBlocked, Message: "Card BIN " + bin + " is blocked"}
+		}
+	}
+
+	if cfg.MaxAmount > 0 && req.Amount > cfg.MaxAmount {
+		return Decision{Code: CodeAmountLimitExceeded, Message: "Amount exceeds the allowed maximum"}
+	}
+
+	e.velocityMu.Lock()
+	defer e.velocityMu.Unlock()
+
+	if now.Sub(e.lastPrune) >= pruneInterval {
+		pruneAttempts(e.cardHits, now, cfg.Velocity.PerCard)
+		pruneAttempts(e.customerHits, now, cfg.Velocity.PerCustomer)
+		e.lastPrune = now
+	}
+
+	cardCount := countAttempts(e.cardHits, req.CardNumber, now, cfg.Velocity.PerCard)
+	customerCount := 0
+	if req.CustomerID > 0 {
+		customerCount = countAttempts(e.customerHits, req.CustomerID, now, cfg.Velocity.PerCustomer)
+	}
+
+	if limit := cfg.Velocity.PerCard; limit.Max > 0 && cardCount > limit.Max {
+		return Decision{Code: CodeVelocityCardLimit, Message: "Too many attempts for this card"}
+	}
+	if limit := cfg.Velocity.PerCustomer; limit.Max > 0 && customerCount > limit.Max {
+		return Decision{Code: CodeVelocityCustomerLimit, Message: "Too many attempts for this customer"}
+	}
+
+	return Decision{Allowed: true}
+}
+
+// countAttempts records an attempt for key and returns the number of
+// attempts inside the limit's window, including this one. Attempts are
+// not tracked while the limit is disabled.
+func countAttempts[K comparable](hits map[K][]time.Time, key K, now time.Time, limit VelocityLimit) int {
+	if limit.Max == 0 {
+		delete(hits, key)
+		return 0
+	}
+
+	cutoff := now.Add(-time.Duration(limit.Window))
+	kept := hits[key][:0]
+	for _, t := range hits[key] {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	kept = append(kept, now)
+	hits[key] = kept
+	return len(kept)
+}
+
+// pruneAttempts deletes every key whose latest attempt has left the
+// limit's window, so cards and customers seen once are not kept forever.
+func pruneAttempts[K comparable](hits map[K][]time.Time, now time.Time, limit VelocityLimit) {
+	cutoff := now.Add(-time.Duration(limit.Window))
+	for key, times := range hits {
+		if limit.Max == 0 || len(times) == 0 || !times[len(times)-1].After(cutoff) {
+			delete(hits, key)
+		}
+	}
+}
+
+func (e *Engine) record(hit Hit) {
+	e.auditMu.Lock()
+	defer e.auditMu.Unlock()
+
+	if len(e.audit) >= auditCapacity {
+		e.audit = e.audit[1:]
+	}
+	e.audit = append(e.audit, hit)
+}
+
+// Hits returns recorded rule hits matching the filter, newest first.
+func (e *Engine) Hits(f HitFilter) []Hit {
+	e.auditMu.Lock()
+	defer e.auditMu.Unlock()
+
+	out := []Hit{}
+	for i := len(e.audit) - 1; i >= 0; i-- {
+		hit := e.audit[i]
+		if f.Code != "" && hit.Code != f.Code {
+			continue
+		}
+		if f.CardLast4 != "" && hit.CardLast4 != f.CardLast4 {
+			continue
+		}
+		if f.CustomerID != 0 && hit.CustomerID != f.CustomerID {
+			continue
+		}
+		out = append(out, hit)
+		if f.Limit > 0 && len(out) >= f.Limit {
+			break
+		}
+	}
+	return out
+}
+
+// WatchFile reloads the rules from path whenever its modification time
+// changes, checking every interval until ctx is cancelled. An invalid file
+// is logged and the previous rules stay in effect.
+func (e *Engine) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	var lastMod time.Time
+	if info, err := os.Stat(path); err == nil {
+		lastMod = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(lastMod) {
+			continue
+		}
+		lastMod = info.ModTime()
+
+		cfg, err := LoadConfig(path)
+		if err != nil {
+			log.Printf("Keeping previous risk rules: %v", err)
+			continue
+		}
+		e.SetConfig(cfg)
+		log.Printf("Reloaded risk rules from %s", path)
+	}
+}
+
+func last4(digits string) string {
+	if len(digits) <= 4 {
+		return digits
+	}
+	return digits[len(digits)-4:]
+}
@@ -0,0 +1,69 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneAttempts(t *testing.T) {
+	var cfg Config
+	cfg.Velocity.PerCard = VelocityLimit{Max: 5, Window: Duration(time.Minute)}
+	cfg.Velocity.PerCustomer = VelocityLimit{Max: 5, Window: Duration(time.Minute)}
+	e := NewEngine(cfg)
+
+	start := time.Now()
+	e.evaluate(cfg, Request{CardNumber: "4242424242424242", CustomerID: 1}, start)
+	e.evaluate(cfg, Request{CardNumber: "4000000000000002", CustomerID: 2}, start.Add(30*time.Second))
+
+	// Both windows are still open at the first prune.
+	e.evaluate(cfg, Request{CardNumber: "4000000000000002", CustomerID: 2}, start.Add(70*time.Second))
+	if len(e.cardHits) != 1 || len(e.customerHits) != 1 {
+		t.Fatalf("after prune: %d cards, %d customers tracked, want 1 and 1", len(e.cardHits), len(e.customerHits))
+	}
+	if _, ok := e.cardHits["4242424242424242"]; ok {
+		t.Error("card with an empty window was not pruned")
+	}
+
+	// Disabling a limit drops everything it tracked.
+	cfg.Velocity.PerCustomer = VelocityLimit{}
+	e.evaluate(cfg, Request{CardNumber: "4000000000000002"}, start.Add(3*time.Minute))
+	if len(e.customerHits) != 0 {
+		t.Errorf("%d customers tracked with the limit disabled, want 0", len(e.customerHits))
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	rules := `{"denied_cards": ["4000-0000-0000-0010", "5555 5555 5555 4444"]}`
+	if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	redacted := cfg.Redacted()
+	if got := strings.Join(redacted.DeniedCards, ","); got != "0010,4444" {
+		t.Errorf("redacted denied_cards = %s, want 0010,4444", got)
+	}
+	if cfg.DeniedCards[0] != "4000000000000010" {
+		t.Errorf("Redacted modified the original config: %v", cfg.DeniedCards)
+	}
+}
+
+func TestExampleRulesAllowTestCards(t *testing.T) {
+	cfg, err := LoadConfig("../risk-rules.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := NewEngine(cfg)
+	for _, card := range []string{"4242424242424242", "4000000000000002", "4000000000000127", "4000000000000036", "4000000000000119"} {
+		if d := e.Evaluate(Request{CardNumber: card, Amount: 100}); !d.Allowed {
+			t.Errorf("example rules decline test card %s: %s", card, d.Code)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"credit-card-authorizer/models"
+)
+
+var (
+	// ErrAccountNotFound is returned when a customer has no account.
+	ErrAccountNotFound = errors.New("account not found")
+
+	// ErrInsufficientFunds is returned when a hold would exceed the credit limit.
+	ErrInsufficientFunds = errors.New("insufficient funds")
+)
+
+// AccountStore keeps simulated customer accounts in memory.
+//
+// If defaultLimit is positive, customers without an account get one with
+// that limit on their first authorization; otherwise they are not limited.
+type AccountStore struct {
+	mu           sync.Mutex
+	accounts     map[int]*models.Account
+	defaultLimit int64
+}
+
+// NewAccountStore creates an empty account store.
+func NewAccountStore(defaultLimit int64) *AccountStore {
+	return &AccountStore{
+		accounts:     make(map[int]*models.Account),
+		defaultLimit: defaultLimit,
+	}
+}
+
+// PutAccount creates or replaces a customer's account.
+func (s *AccountStore) PutAccount(customerID int, creditLimit, balance int64) models.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct := &models.Account{
+		CustomerID:  customerID,
+		CreditLimit: creditLimit,
+		Balance:     balance,
+	}
+	touch(acct)
+	s.accounts[customerID] = acct
+	return *acct
+}
+
+// GetAccount returns a customer's account.
+func (s *AccountStore) GetAccount(customerID int) (models.Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct, exists := s.accounts[customerID]
+	if !exists {
+		return models.Account{}, ErrAccountNotFound
+	}
+	return *acct, nil
+}
+
+// ListAccounts returns all accounts ordered by customer ID.
+func (s *AccountStore) ListAccounts() []models.Account {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	out := make([]models.Account, 0, len(s.accounts))
+	for _, acct := range s.accounts {
+		out = append(out, *acct)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CustomerID < out[j].CustomerID })
+	return out
+}
+
+// Reserve places a hold of amount on the customer's account. It returns
+// ErrInsufficientFunds if the hold would exceed the credit limit. Customers
+// without an account are not limited unless a default limit is configured.
+// A non-positive amount places no hold.
+func (s *AccountStore) Reserve(customerID int, amount int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if amount <= 0 {
+		return nil
+	}
+	acct, exists := s.accounts[customerID]
+	if !exists {
+		if s.defaultLimit <= 0 {
+			return nil
+		}
+		acct = &models.Account{CustomerID: customerID, CreditLimit: s.defaultLimit}
+		s.accounts[customerID] = acct
+	}
+
+	// Compared against the remaining credit so a huge amount cannot overflow
+	if amount > acct.CreditLimit-acct.Balance {
+		return ErrInsufficientFunds
+	}
+	acct.Balance += amount
+	touch(acct)
+	return nil
+}
+
+// Release returns amount to the customer's available credit, e.g. after a
+// void, a partial capture or a refund.
+func (s *AccountStore) Release(customerID int, amount int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	acct, exists := s.accounts[customerID]
+	if !exists || amount <= 0 {
+		return
+	}
+	acct.Balance -= amount
+	if acct.Balance < 0 {
+		acct.Balance = 0
+	}
+	touch(acct)
+}
+
+func touch(acct *models.Account) {
+	acct.Available = acct.CreditLimit - acct.Balance
+	acct.UpdatedAt = time.Now().UTC()
+}
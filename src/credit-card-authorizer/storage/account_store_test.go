@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"credit-card-authorizer/models"
+)
+
+func TestReserveAtLimit(t *testing.T) {
+	s := NewAccountStore(0)
+	s.PutAccount(1, 1000, 400)
+
+	if err := s.Reserve(1, 600); err != nil {
+		t.Fatalf("reserve up to the limit: %v", err)
+	}
+	if err := s.Reserve(1, 1); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("reserve past the limit = %v, want ErrInsufficientFunds", err)
+	}
+
+	s.Release(1, 600)
+	if err := s.Reserve(1, 601); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("reserve one over the released credit = %v, want ErrInsufficientFunds", err)
+	}
+	acct, _ := s.GetAccount(1)
+	if acct.Balance != 400 || acct.Available != 600 {
+		t.Fatalf("balance %d available %d, want 400 and 600", acct.Balance, acct.Available)
+	}
+
+	// 释放超过余额的金额不会让余额变成负数
+	s.Release(1, 10_000)
+	if acct, _ := s.GetAccount(1); acct.Balance != 0 || acct.Available != 1000 {
+		t.Fatalf("balance %d available %d after over-release, want 0 and 1000", acct.Balance, acct.Available)
+	}
+}
+
+func TestReserveOverflow(t *testing.T) {
+	s := NewAccountStore(0)
+	s.PutAccount(1, math.MaxInt64, math.MaxInt64-10)
+
+	// Balance+amount 会溢出成负数，旧的检查会放行
+	if err := s.Reserve(1, math.MaxInt64); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("overflowing reserve = %v, want ErrInsufficientFunds", err)
+	}
+	if err := s.Reserve(1, 10); err != nil {
+		t.Fatalf("reserve the remaining credit: %v", err)
+	}
+	if acct, _ := s.GetAccount(1); acct.Balance != math.MaxInt64 || acct.Available != 0 {
+		t.Fatalf("balance %d available %d, want the full limit held", acct.Balance, acct.Available)
+	}
+}
+
+func TestReserveDefaultLimit(t *testing.T) {
+	unlimited := NewAccountStore(0)
+	if err := unlimited.Reserve(7, math.MaxInt64); err != nil {
+		t.Fatalf("customer without an account limited: %v", err)
+	}
+
+	s := NewAccountStore(500)
+	if err := s.Reserve(7, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetAccount(7); !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("zero amount created an account: %v", err)
+	}
+	if err := s.Reserve(7, 501); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("reserve over the default limit = %v, want ErrInsufficientFunds", err)
+	}
+	if err := s.Reserve(7, 500); err != nil {
+		t.Fatalf("reserve the default limit: %v", err)
+	}
+}
+
+// 下面两个用例按 handler 的顺序操作：授权时 Reserve，void/refund 后 Release
+func TestReleaseAfterVoid(t *testing.T) {
+	accounts := NewAccountStore(0)
+	accounts.PutAccount(1, 1000, 0)
+	store := NewMemoryStore()
+
+	if err := accounts.Reserve(1, 800); err != nil {
+		t.Fatal(err)
+	}
+	store.CreateAuthorization(models.Authorization{AuthorizationID: "a1", CustomerID: 1, Amount: 800})
+	if err := accounts.Reserve(1, 800); !errors.Is(err, ErrInsufficientFunds) {
+		t.Fatalf("second hold = %v, want ErrInsufficientFunds", err)
+	}
+
+	auth, err := store.Void("a1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.Release(auth.CustomerID, auth.Amount)
+	if err := accounts.Reserve(1, 800); err != nil {
+		t.Fatalf("hold after void: %v", err)
+	}
+}
+
+func TestReleaseAfterRefund(t *testing.T) {
+	accounts := NewAccountStore(0)
+	accounts.PutAccount(1, 1000, 0)
+	store := NewMemoryStore()
+
+	if err := accounts.Reserve(1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	store.CreateAuthorization(models.Authorization{AuthorizationID: "a1", CustomerID: 1, Amount: 1000})
+	if _, err := store.Capture("a1", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	auth, released, err := store.Refund("a1", 300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.Release(auth.CustomerID, released)
+	if acct, _ := accounts.GetAccount(1); acct.Available != 300 {
+		t.Fatalf("available %d after partial refund, want 300", acct.Available)
+	}
+
+	auth, released, err = store.Refund("a1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accounts.Release(auth.CustomerID, released)
+	if acct, _ := accounts.GetAccount(1); acct.Available != 1000 || acct.Balance != 0 {
+		t.Fatalf("balance %d available %d after full refund, want 0 and 1000", acct.Balance, acct.Available)
+	}
+}
@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"credit-card-authorizer/models"
+)
+
+var (
+	// ErrNotFound is returned when an authorization is not found.
+	ErrNotFound = errors.New("authorization not found")
+
+	// ErrInvalidTransition is returned when an operation is not allowed
+	// in the authorization's current state.
+	ErrInvalidTransition = errors.New("invalid state transition")
+
+	// ErrInvalidAmount is returned when a capture or refund amount exceeds
+	// what is available.
+	ErrInvalidAmount = errors.New("invalid amount")
+)
+
+// MemoryStore provides in-memory storage for authorizations and enforces
+// their state transitions.
+//
+// Authorizations live in this process only, so the authorizer must run as a
+// single instance: a capture or void routed to another instance would not
+// find the hold.
+type MemoryStore struct {
+	mu             sync.Mutex
+	authorizations map[string]*models.Authorization
+
+	// byKey maps a caller's idempotency key to the authorization it created.
+	byKey map[string]string
+}
+
+// NewMemoryStore creates a new in-memory authorization store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		authorizations: make(map[string]*models.Authorization),
+		byKey:          make(map[string]string),
+	}
+}
+
+// CreateAuthorization stores a new authorization in the authorized state.
+// If an authorization with the same IdempotencyKey exists, that one is
+// returned instead and created is false.
+func (s *MemoryStore) CreateAuthorization(auth models.Authorization) (stored models.Authorization, created bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if existing, ok := s.byKeyLocked(auth.IdempotencyKey); ok {
+		return *existing, false
+	}
+
+	now := time.Now().UTC()
+	auth.Status = models.StatusAuthorized
+	auth.CreatedAt = now
+	auth.UpdatedAt = now
+
+	stored = auth
+	s.authorizations[auth.AuthorizationID] = &stored
+	if auth.IdempotencyKey != "" {
+		s.byKey[auth.IdempotencyKey] = auth.AuthorizationID
+	}
+	return stored, true
+}
+
+// FindByIdempotencyKey returns the authorization created with key.
+func (s *MemoryStore) FindByIdempotencyKey(key string) (models.Authorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.byKeyLocked(key)
+	if !ok {
+		return models.Authorization{}, ErrNotFound
+	}
+	return *auth, nil
+}
+
+// byKeyLocked looks up an authorization by idempotency key; the caller
+// must hold s.mu.
+func (s *MemoryStore) byKeyLocked(key string) (*models.Authorization, bool) {
+	if key == "" {
+		return nil, false
+	}
+	auth, ok := s.authorizations[s.byKey[key]]
+	return auth, ok
+}
+
+// GetAuthorization retrieves an authorization by its ID.
+func (s *MemoryStore) GetAuthorization(id string) (models.Authorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, exists := s.authorizations[id]
+	if !exists {
+		return models.Authorization{}, ErrNotFound
+	}
+	return *auth, nil
+}
+
+// Capture settles an authorized hold. amount 0 captures the full
+// authorized amount; otherwise it must not exceed it.
+func (s *MemoryStore) Capture(id string, amount int64) (models.Authorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, exists := s.authorizations[id]
+	if !exists {
+		return models.Authorization{}, ErrNotFound
+	}
+	if auth.Status != models.StatusAuthorized {
+		return *auth, ErrInvalidTransition
+	}
+	if amount == 0 {
+		amount = auth.Amount
+	}
+	if amount < 0 || amount > auth.Amount {
+		return *auth, ErrInvalidAmount
+	}
+
+	auth.Status = models.StatusCaptured
+	auth.CapturedAmount = amount
+	auth.UpdatedAt = time.Now().UTC()
+	return *auth, nil
+}
+
+// Void releases an authorized hold that has not been captured.
+func (s *MemoryStore) Void(id string) (models.Authorization, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, exists := s.authorizations[id]
+	if !exists {
+		return models.Authorization{}, ErrNotFound
+	}
+	if auth.Status != models.StatusAuthorized {
+		return *auth, ErrInvalidTransition
+	}
+
+	auth.Status = models.StatusVoided
+	auth.UpdatedAt = time.Now().UTC()
+	return *auth, nil
+}
+
+// Refund returns captured funds and reports the amount refunded. amount 0
+// refunds everything not yet refunded; partial refunds keep the
+// authorization in the captured state until the full captured amount has
+// been refunded.
+func (s *MemoryStore) Refund(id string, amount int64) (models.Authorization, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, exists := s.authorizations[id]
+	if !exists {
+		return models.Authorization{}, 0, ErrNotFound
+	}
+	if auth.Status != models.StatusCaptured {
+		return *auth, 0, ErrInvalidTransition
+	}
+
+	remaining := auth.CapturedAmount - auth.RefundedAmount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount < 0 || amount > remaining {
+		return *auth, 0, ErrInvalidAmount
+	}
+
+	auth.RefundedAmount += amount
+	if auth.RefundedAmount == auth.CapturedAmount {
+		auth.Status = models.StatusRefunded
+	}
+	auth.UpdatedAt = time.Now().UTC()
+	return *auth, amount, nil
+}
+
+// EvictFinished removes voided, refunded and expired authorizations last
+// updated before cutoff and reports how many were removed.
+func (s *MemoryStore) EvictFinished(cutoff time.Time) int {
+	return s.evict(cutoff, models.StatusVoided, models.StatusRefunded, models.StatusExpired)
+}
+
+// EvictCaptured removes captured authorizations last updated before cutoff
+// and reports how many were removed. They can no longer be refunded.
+func (s *MemoryStore) EvictCaptured(cutoff time.Time) int {
+	return s.evict(cutoff, models.StatusCaptured)
+}
+
+func (s *MemoryStore) evict(cutoff time.Time, statuses ...models.Status) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for id, auth := range s.authorizations {
+		if !slices.Contains(statuses, auth.Status) || !auth.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		delete(s.authorizations, id)
+		if auth.IdempotencyKey != "" {
+			delete(s.byKey, auth.IdempotencyKey)
+		}
+		evicted++
+	}
+	return evicted
+}
+
+// ExpireHolds moves authorizations still authorized since before cutoff to
+// expired and returns them, so the caller can release the credit they hold.
+// Capturing or voiding an expired hold fails with ErrInvalidTransition.
+func (s *MemoryStore) ExpireHolds(cutoff time.Time) []models.Authorization {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var expired []models.Authorization
+	now := time.Now().UTC()
+	for _, auth := range s.authorizations {
+		if auth.Status != models.StatusAuthorized || !auth.CreatedAt.Before(cutoff) {
+			continue
+		}
+		auth.Status = models.StatusExpired
+		auth.UpdatedAt = now
+		expired = append(expired, *auth)
+	}
+	return expired
+}
+
+// SweepPolicy says how long Sweep keeps authorizations in each state.
+type SweepPolicy struct {
+	// HoldTTL is how long a hold may stay authorized before it expires.
+	HoldTTL time.Duration
+	// CapturedTTL is how long captured authorizations are kept for refunds.
+	CapturedTTL time.Duration
+	// FinishedTTL is how long voided, refunded and expired ones are kept.
+	FinishedTTL time.Duration
+	// OnExpire is called for every hold that expired, outside the lock.
+	OnExpire func(models.Authorization)
+}
+
+// Sweep applies policy every interval until ctx is cancelled.
+func (s *MemoryStore) Sweep(ctx context.Context, policy SweepPolicy, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.sweep(time.Now().UTC(), policy)
+	}
+}
+
+func (s *MemoryStore) sweep(now time.Time, policy SweepPolicy) {
+	expired := s.ExpireHolds(now.Add(-policy.HoldTTL))
+	for _, auth := range expired {
+		if policy.OnExpire != nil {
+			policy.OnExpire(auth)
+		}
+	}
+	if len(expired) > 0 {
+		log.Printf("Expired %d authorization holds", len(expired))
+	}
+	if n := s.EvictCaptured(now.Add(-policy.CapturedTTL)); n > 0 {
+		log.Printf("Evicted %d captured authorizations", n)
+	}
+	if n := s.EvictFinished(now.Add(-policy.FinishedTTL)); n > 0 {
+		log.Printf("Evicted %d finished authorizations", n)
+	}
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"credit-card-authorizer/models"
+)
+
+func TestEvictFinished(t *testing.T) {
+	s := NewMemoryStore()
+	for _, id := range []string{"authorized", "captured", "voided", "refunded"} {
+		s.CreateAuthorization(models.Authorization{AuthorizationID: id, Amount: 100})
+	}
+	if _, err := s.Capture("captured", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Void("voided"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Capture("refunded", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Refund("refunded", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.EvictFinished(time.Now().UTC().Add(-time.Hour)); n != 0 {
+		t.Fatalf("evicted %d recent authorizations, want 0", n)
+	}
+	if n := s.EvictFinished(time.Now().UTC().Add(time.Second)); n != 2 {
+		t.Fatalf("evicted %d authorizations, want 2", n)
+	}
+
+	for id, want := range map[string]bool{"authorized": true, "captured": true, "voided": false, "refunded": false} {
+		_, err := s.GetAuthorization(id)
+		if got := err == nil; got != want {
+			t.Errorf("%s kept = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	s := NewMemoryStore()
+	first, created := s.CreateAuthorization(models.Authorization{AuthorizationID: "a1", IdempotencyKey: "k", Amount: 100})
+	if !created {
+		t.Fatal("first authorization not created")
+	}
+	second, created := s.CreateAuthorization(models.Authorization{AuthorizationID: "a2", IdempotencyKey: "k", Amount: 100})
+	if created || second.AuthorizationID != first.AuthorizationID {
+		t.Fatalf("repeated key created %v, returned %s; want the existing a1", created, second.AuthorizationID)
+	}
+	if _, created := s.CreateAuthorization(models.Authorization{AuthorizationID: "a3", Amount: 100}); !created {
+		t.Fatal("authorization without a key not created")
+	}
+
+	found, err := s.FindByIdempotencyKey("k")
+	if err != nil || found.AuthorizationID != "a1" {
+		t.Fatalf("FindByIdempotencyKey = %s, %v; want a1", found.AuthorizationID, err)
+	}
+	if _, err := s.FindByIdempotencyKey(""); err != ErrNotFound {
+		t.Fatalf("empty key: err = %v, want ErrNotFound", err)
+	}
+
+	if _, err := s.Void("a1"); err != nil {
+		t.Fatal(err)
+	}
+	s.EvictFinished(time.Now().UTC().Add(time.Second))
+	if _, err := s.FindByIdempotencyKey("k"); err != ErrNotFound {
+		t.Fatalf("after eviction: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestEvictCaptured(t *testing.T) {
+	s := NewMemoryStore()
+	for _, id := range []string{"authorized", "captured", "refunded"} {
+		s.CreateAuthorization(models.Authorization{AuthorizationID: id, Amount: 100})
+	}
+	if _, err := s.Capture("captured", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Capture("refunded", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.Refund("refunded", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := s.EvictCaptured(time.Now().UTC().Add(-time.Hour)); n != 0 {
+		t.Fatalf("evicted %d recent captures, want 0", n)
+	}
+	if n := s.EvictCaptured(time.Now().UTC().Add(time.Second)); n != 1 {
+		t.Fatalf("evicted %d authorizations, want 1", n)
+	}
+	for id, want := range map[string]bool{"authorized": true, "captured": false, "refunded": true} {
+		_, err := s.GetAuthorization(id)
+		if got := err == nil; got != want {
+			t.Errorf("%s kept = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestExpireHolds(t *testing.T) {
+	s := NewMemoryStore()
+	for _, id := range []string{"held", "captured", "voided"} {
+		s.CreateAuthorization(models.Authorization{AuthorizationID: id, Amount: 100})
+	}
+	if _, err := s.Capture("captured", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Void("voided"); err != nil {
+		t.Fatal(err)
+	}
+
+	if expired := s.ExpireHolds(time.Now().UTC().Add(-time.Hour)); len(expired) != 0 {
+		t.Fatalf("expired %d recent holds, want 0", len(expired))
+	}
+	expired := s.ExpireHolds(time.Now().UTC().Add(time.Second))
+	if len(expired) != 1 || expired[0].AuthorizationID != "held" || expired[0].Status != models.StatusExpired {
+		t.Fatalf("expired %+v, want only held", expired)
+	}
+	if again := s.ExpireHolds(time.Now().UTC().Add(time.Second)); len(again) != 0 {
+		t.Fatalf("expired %d holds twice", len(again))
+	}
+
+	// 过期的 hold 不能再 capture 或 void，额度也就不会被还两次
+	if _, err := s.Capture("held", 0); err != ErrInvalidTransition {
+		t.Fatalf("capture after expiry: err = %v, want ErrInvalidTransition", err)
+	}
+	if _, err := s.Void("held"); err != ErrInvalidTransition {
+		t.Fatalf("void after expiry: err = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestSweepReleasesExpiredHolds(t *testing.T) {
+	s := NewMemoryStore()
+	accounts := NewAccountStore(0)
+	accounts.PutAccount(1, 1000, 0)
+	for _, id := range []string{"a1", "a2"} {
+		if err := accounts.Reserve(1, 400); err != nil {
+			t.Fatal(err)
+		}
+		s.CreateAuthorization(models.Authorization{AuthorizationID: id, CustomerID: 1, Amount: 400})
+	}
+	if _, err := s.Capture("a2", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	policy := SweepPolicy{
+		HoldTTL:     time.Hour,
+		CapturedTTL: 2 * time.Hour,
+		FinishedTTL: 3 * time.Hour,
+		OnExpire: func(auth models.Authorization) {
+			accounts.Release(auth.CustomerID, auth.Amount)
+		},
+	}
+	now := time.Now().UTC()
+
+	s.sweep(now, policy)
+	if acct, _ := accounts.GetAccount(1); acct.Balance != 800 {
+		t.Fatalf("balance %d before the hold TTL, want 800", acct.Balance)
+	}
+
+	s.sweep(now.Add(time.Hour+time.Second), policy)
+	if acct, _ := accounts.GetAccount(1); acct.Balance != 400 {
+		t.Fatalf("balance %d after the hold expired, want 400 (the capture only)", acct.Balance)
+	}
+	if auth, err := s.GetAuthorization("a1"); err != nil || auth.Status != models.StatusExpired {
+		t.Fatalf("a1 = %s, %v; want expired", auth.Status, err)
+	}
+
+	s.sweep(now.Add(2*time.Hour+time.Second), policy)
+	if _, err := s.GetAuthorization("a2"); err != ErrNotFound {
+		t.Fatalf("captured a2 not evicted after its TTL: %v", err)
+	}
+	if _, err := s.GetAuthorization("a1"); err != nil {
+		t.Fatalf("expired a1 evicted before its TTL: %v", err)
+	}
+
+	s.sweep(now.Add(4*time.Hour+2*time.Second), policy)
+	if _, err := s.GetAuthorization("a1"); err != ErrNotFound {
+		t.Fatalf("expired a1 not evicted after its TTL: %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"credit-card-authorizer/models"
+)
+
+// ErrTokenNotFound is returned when a card token is unknown.
+var ErrTokenNotFound = errors.New("card token not found")
+
+// TokenVault maps opaque card tokens to card numbers in memory.
+// Tokenizing the same card number again returns the existing token.
+// Tokens not used for a while are removed by Sweep, taking the card number
+// with them.
+type TokenVault struct {
+	mu       sync.Mutex
+	byToken  map[string]models.CardToken
+	byPAN    map[string]string
+	lastUsed map[string]time.Time
+}
+
+// NewTokenVault creates an empty token vault.
+func NewTokenVault() *TokenVault {
+	return &TokenVault{
+		byToken:  make(map[string]models.CardToken),
+		byPAN:    make(map[string]string),
+		lastUsed: make(map[string]time.Time),
+	}
+}
+
+// Tokenize stores card under card.Token, or returns the token already
+// issued for card.PAN. A newly supplied expiry replaces the stored one.
+func (v *TokenVault) Tokenize(card models.CardToken) models.CardToken {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now().UTC()
+	if token, exists := v.byPAN[card.PAN]; exists {
+		v.lastUsed[token] = now
+		stored := v.byToken[token]
+		if card.Expiry != "" {
+			stored.Expiry = card.Expiry
+			v.byToken[token] = stored
+		}
+		return stored
+	}
+
+	card.CreatedAt = now
+	v.byToken[card.Token] = card
+	v.byPAN[card.PAN] = card.Token
+	v.lastUsed[card.Token] = now
+	return card
+}
+
+// Detokenize returns the card stored under token.
+func (v *TokenVault) Detokenize(token string) (models.CardToken, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	card, exists := v.byToken[token]
+	if !exists {
+		return models.CardToken{}, ErrTokenNotFound
+	}
+	v.lastUsed[token] = time.Now().UTC()
+	return card, nil
+}
+
+// EvictIdle removes tokens last tokenized or detokenized before cutoff,
+// together with their card numbers, and reports how many were removed.
+func (v *TokenVault) EvictIdle(cutoff time.Time) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	evicted := 0
+	for token, used := range v.lastUsed {
+		if !used.Before(cutoff) {
+			continue
+		}
+		delete(v.byPAN, v.byToken[token].PAN)
+		delete(v.byToken, token)
+		delete(v.lastUsed, token)
+		evicted++
+	}
+	return evicted
+}
+
+// Sweep evicts tokens idle for longer than ttl, checking every interval
+// until ctx is cancelled.
+func (v *TokenVault) Sweep(ctx context.Context, ttl, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n := v.EvictIdle(time.Now().UTC().Add(-ttl)); n > 0 {
+			log.Printf("Evicted %d idle card tokens", n)
+		}
+	}
+}
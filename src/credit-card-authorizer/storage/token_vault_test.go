@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"credit-card-authorizer/models"
+)
+
+func TestEvictIdle(t *testing.T) {
+	v := NewTokenVault()
+	idle := v.Tokenize(models.CardToken{Token: "tok_idle", PAN: "4242424242424242"})
+	used := v.Tokenize(models.CardToken{Token: "tok_used", PAN: "4000000000000002"})
+
+	cutoff := time.Now().UTC().Add(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if _, err := v.Detokenize(used.Token); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := v.EvictIdle(cutoff); n != 1 {
+		t.Fatalf("evicted %d tokens, want 1", n)
+	}
+	if _, err := v.Detokenize(idle.Token); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("idle token still resolves: %v", err)
+	}
+	if _, err := v.Detokenize(used.Token); err != nil {
+		t.Errorf("recently used token evicted: %v", err)
+	}
+
+	// The card number is gone too, so tokenizing it again issues a new token.
+	if again := v.Tokenize(models.CardToken{Token: "tok_new", PAN: idle.PAN}); again.Token != "tok_new" {
+		t.Errorf("re-tokenized card got %s, want tok_new", again.Token)
+	}
+}
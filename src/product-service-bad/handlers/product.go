@@ -21,23 +21,30 @@ type ErrorResponse struct {
 	Details *string `json:"details,omitempty"`
 }
 
+// defaultCurrency is applied to products created without a currency.
+const defaultCurrency = "USD"
+
 // Handler exposes HTTP handlers for product operations.
 type Handler struct {
-	store      *storage.MemoryStore
+	store       *storage.MemoryStore
 	failureRate float32
-	rng        *rand.Rand
+	rng         *rand.Rand
 }
 
 // NewHandler creates a Handler backed by the provided store.
 // failureRate: probability of returning 503 error (0.0 to 1.0)
 func NewHandler(store *storage.MemoryStore, failureRate float32) *Handler {
 	return &Handler{
-		store:      store,
+		store:       store,
 		failureRate: failureRate,
-		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		rng:         rand.New(rand.NewSource(time.Now().UnixNano())),
 	}
 }
 
+// Routes lists the paths served under the subtree patterns registered by
+// RegisterRoutes, for naming requests in metrics and traces.
+var Routes = []string{"/products/{id}"}
+
 // RegisterRoutes wires product routes onto the provided mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/products/", h.handleProducts)
@@ -50,17 +57,17 @@ func (h *Handler) handleProducts(w http.ResponseWriter, r *http.Request) {
 		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "Invalid path")
 		return
 	}
-	
+
 	if strings.Contains(path, "/") {
 		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "Invalid path")
 		return
 	}
-	
+
 	if r.Method != "GET" {
 		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
 		return
 	}
-	
+
 	h.handleGetProduct(w, r, path)
 }
 
@@ -111,6 +118,10 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if payload.Currency == "" {
+		payload.Currency = defaultCurrency
+	}
+
 	if validationErr := validateProductPayload(payload); validationErr != nil {
 		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", validationErr.Error())
 		return
@@ -163,10 +174,34 @@ func validateProductPayload(product models.Product) error {
 	if product.SomeOtherID < 1 {
 		return errors.New("some_other_id must be a positive integer")
 	}
+	if product.Price < 0 {
+		return errors.New("price must be non-negative")
+	}
+	if !isCurrencyCode(product.Currency) {
+		return errors.New("currency must be a 3-letter ISO 4217 code")
+	}
+
+	// Purchase limit validation
+	if product.MaxPerOrder < 0 {
+		return errors.New("max_per_order must be non-negative")
+	}
 
 	return nil
 }
 
+// isCurrencyCode reports whether s looks like an ISO 4217 code ("USD").
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 func (h *Handler) writeError(w http.ResponseWriter, status int, code, message string) {
 	writeJSON(w, status, ErrorResponse{Error: code, Message: message})
 }
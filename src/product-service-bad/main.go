@@ -1,27 +1,81 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"common/metrics"
+	"common/routes"
+	"common/tracing"
 
 	"product-service/handlers"
 	"product-service/storage"
 )
 
 func main() {
+	// Export spans (OTEL_EXPORTER_OTLP_ENDPOINT or TRACE_FILE)
+	stopTracing, err := tracing.Init("product-service-bad")
+	if err != nil {
+		log.Fatalf("failed to start tracing: %v", err)
+	}
+
 	// Create storage
 	store := storage.NewMemoryStore()
 
+	// Every instance loads the same PRODUCT_CATALOG, so its products resolve
+	// on whichever instance the load balancer picks. Products created with
+	// POST /product exist only on the instance that created them.
+	if path := os.Getenv("PRODUCT_CATALOG"); path != "" {
+		products, err := handlers.LoadCatalog(path)
+		if err != nil {
+			log.Fatalf("failed to load product catalog: %v", err)
+		}
+		store.Seed(products)
+		log.Printf("Loaded %d products from %s", len(products), path)
+	}
+
 	// Create handler with 50% failure rate
 	handler := handlers.NewHandler(store, 0.5)
 
 	// Create mux
 	mux := http.NewServeMux()
 
-	// Register routes
+	// Register routes; Prometheus metrics are served at /metrics
 	handler.RegisterRoutes(mux)
+	mux.Handle("/metrics", metrics.Handler())
+
+	// Start server, counting and timing every request by route and status
+	// and continuing the caller's trace
+	names := routes.New(mux, handlers.Routes...)
+	srv := &http.Server{Addr: ":8080", Handler: tracing.Middleware(metrics.Instrument(mux, names), names)}
+
+	go func() {
+		log.Println("Starting BAD product service on :8080 (50% failure rate)")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then stop accepting connections and let
+	// in-flight requests finish before exiting.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
 
-	// Start server
-	log.Println("Starting BAD product service on :8080 (50% failure rate)")
-	log.Fatal(http.ListenAndServe(":8080", mux))
+	log.Println("Shutting down bad product service...")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("graceful shutdown failed: %v", err)
+	}
+	if err := stopTracing(ctx); err != nil {
+		log.Printf("flushing traces failed: %v", err)
+	}
+	log.Println("Bad product service stopped")
 }
@@ -8,4 +8,11 @@ type Product struct {
 	CategoryID   int    `json:"category_id"`
 	Weight       int    `json:"weight"`
 	SomeOtherID  int    `json:"some_other_id"`
+
+	// Price is in minor units (e.g. cents) of Currency, an ISO 4217 code.
+	Price    int64  `json:"price"`
+	Currency string `json:"currency"`
+
+	// MaxPerOrder caps the quantity of this product in one order. 0 means no limit.
+	MaxPerOrder int `json:"max_per_order,omitempty"`
 }
@@ -36,6 +36,20 @@ func (s *MemoryStore) GetProduct(id int) (models.Product, error) {
 	return product, nil
 }
 
+// Seed stores products with the IDs they carry. Generated IDs continue
+// after the largest seeded one.
+func (s *MemoryStore) Seed(products []models.Product) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range products {
+		s.products[p.ProductID] = p
+		if p.ProductID >= s.nextID {
+			s.nextID = p.ProductID + 1
+		}
+	}
+}
+
 // CreateProduct creates a new product and returns the generated ID.
 func (s *MemoryStore) CreateProduct(product models.Product) int {
 	s.mu.Lock()
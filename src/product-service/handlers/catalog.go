@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"product-service/models"
+)
+
+// LoadCatalog reads the JSON array of products at path, e.g. the
+// PRODUCT_CATALOG file. Unlike POST /product, each product brings its own
+// product_id, so every instance loading the file serves the same IDs.
+func LoadCatalog(path string) ([]models.Product, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var products []models.Product
+	if err := json.Unmarshal(data, &products); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	seen := make(map[int]bool, len(products))
+	for i := range products {
+		p := &products[i]
+		if p.Currency == "" {
+			p.Currency = defaultCurrency
+		}
+		if p.ProductID < 1 || seen[p.ProductID] {
+			return nil, fmt.Errorf("catalog entry %d: product_id must be a unique positive integer", i+1)
+		}
+		if err := validateCreateProductPayload(*p); err != nil {
+			return nil, fmt.Errorf("product %d: %w", p.ProductID, err)
+		}
+		seen[p.ProductID] = true
+	}
+	return products, nil
+}
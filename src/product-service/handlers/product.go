@@ -19,6 +19,9 @@ type ErrorResponse struct {
 	Details *string `json:"details,omitempty"`
 }
 
+// defaultCurrency is applied to products created without a currency.
+const defaultCurrency = "USD"
+
 // CreateProductResponse models the response for creating a product.
 type CreateProductResponse struct {
 	ProductID int `json:"product_id"`
@@ -34,6 +37,10 @@ func NewHandler(store *storage.MemoryStore) *Handler {
 	return &Handler{store: store}
 }
 
+// Routes lists the paths served under the subtree patterns registered by
+// RegisterRoutes, for naming requests in metrics and traces.
+var Routes = []string{"/products/{id}"}
+
 // RegisterRoutes wires product routes onto the provided mux.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/product", h.handleCreateProduct)
@@ -69,6 +76,11 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Products created before pricing existed have no currency
+	if payload.Currency == "" {
+		payload.Currency = defaultCurrency
+	}
+
 	// Validate required fields (except product_id, which server generates)
 	if err := validateCreateProductPayload(payload); err != nil {
 		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
@@ -182,9 +194,35 @@ func validateCreateProductPayload(product models.Product) error {
 		return errors.New("some_other_id must be a positive integer")
 	}
 
+	// Price validation
+	if product.Price < 0 {
+		return errors.New("price must be non-negative")
+	}
+	if !isCurrencyCode(product.Currency) {
+		return errors.New("currency must be a 3-letter ISO 4217 code")
+	}
+
+	// Purchase limit validation
+	if product.MaxPerOrder < 0 {
+		return errors.New("max_per_order must be non-negative")
+	}
+
 	return nil
 }
 
+// isCurrencyCode reports whether s looks like an ISO 4217 code ("USD").
+func isCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, c := range s {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
 // writeError writes an error response in the OpenAPI-specified format.
 func (h *Handler) writeError(w http.ResponseWriter, status int, code, message string) {
 	writeJSON(w, status, ErrorResponse{
@@ -198,4 +236,4 @@ func writeJSON(w http.ResponseWriter, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(data)
-}
\ No newline at end of file
+}
@@ -37,6 +37,20 @@ func (s *MemoryStore) GenerateNextProductID() int {
 	return id
 }
 
+// Seed stores products with the IDs they carry. Generated IDs continue
+// after the largest seeded one.
+func (s *MemoryStore) Seed(products []models.Product) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range products {
+		s.products[p.ProductID] = p
+		if p.ProductID >= s.nextProductID {
+			s.nextProductID = p.ProductID + 1
+		}
+	}
+}
+
 // CreateProduct stores a new product and returns its ID.
 func (s *MemoryStore) CreateProduct(product models.Product) int {
 	s.mu.Lock()
@@ -0,0 +1,139 @@
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+
+	"shopping-cart-service/models"
+	"shopping-cart-service/storage"
+)
+
+// AbandonedQueue receives a CartAbandoned event for every expired cart
+// that still held items.
+const AbandonedQueue = "carts.abandoned"
+
+var (
+	cartsSwept     = expvar.NewInt("carts_swept")
+	cartsAbandoned = expvar.NewInt("carts_abandoned")
+)
+
+// publisher is the part of *amqp.Channel the sweeper uses.
+type publisher interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+}
+
+// Sweeper periodically deletes carts that have not been updated for ttl.
+type Sweeper struct {
+	store    storage.Store
+	ttl      time.Duration
+	interval time.Duration
+	ch       publisher
+}
+
+// NewSweeper creates a sweeper that checks every interval for carts idle
+// longer than ttl and publishes abandoned events on ch.
+func NewSweeper(store storage.Store, ttl, interval time.Duration, ch publisher) *Sweeper {
+	return &Sweeper{
+		store:    store,
+		ttl:      ttl,
+		interval: interval,
+		ch:       ch,
+	}
+}
+
+// DeclareQueue declares the durable abandoned-cart queue.
+func DeclareQueue(ch *amqp.Channel) error {
+	_, err := ch.QueueDeclare(
+		AbandonedQueue,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		nil,
+	)
+	return err
+}
+
+// Run sweeps until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.sweep(now)
+		}
+	}
+}
+
+// sweep expires idle carts. Carts emptied by checkout are dropped
+// silently; carts that still hold items are reported as abandoned.
+func (s *Sweeper) sweep(now time.Time) {
+	expired := s.store.ExpireIdle(now.Add(-s.ttl))
+	if len(expired) == 0 {
+		return
+	}
+	cartsSwept.Add(int64(len(expired)))
+
+	abandoned := 0
+	for _, cart := range expired {
+		if len(cart.Items) == 0 {
+			continue
+		}
+		abandoned++
+		if err := s.publish(cart, now); err != nil {
+			log.Printf("ERROR: failed to publish abandoned cart %d: %v", cart.ShoppingCartID, err)
+		}
+	}
+	cartsAbandoned.Add(int64(abandoned))
+
+	log.Printf("Swept %d idle carts (%d abandoned with items)", len(expired), abandoned)
+}
+
+func (s *Sweeper) publish(cart models.ShoppingCart, now time.Time) error {
+	items := make([]messages.OrderItem, 0, len(cart.Items))
+	for _, item := range cart.Items {
+		items = append(items, messages.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+
+	body, err := json.Marshal(messages.CartAbandoned{
+		Event:          messages.CartAbandonedEvent,
+		CartID:         cart.ShoppingCartID,
+		CustomerID:     cart.CustomerID,
+		Items:          items,
+		CouponCode:     cart.CouponCode,
+		CreatedAt:      cart.CreatedAt,
+		LastActivityAt: cart.UpdatedAt,
+		AbandonedAt:    now.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.ch.Publish(
+		"",
+		AbandonedQueue,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Type:         messages.CartAbandonedEvent,
+			Timestamp:    now.UTC(),
+			Body:         body,
+		},
+	)
+}
@@ -0,0 +1,134 @@
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+
+	"shopping-cart-service/storage"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakePublisher records abandoned cart events.
+type fakePublisher struct {
+	mu   sync.Mutex
+	sent []messages.CartAbandoned
+}
+
+func (p *fakePublisher) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	if key != AbandonedQueue {
+		return errors.New("published to " + key)
+	}
+	var event messages.CartAbandoned
+	if err := json.Unmarshal(msg.Body, &event); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.sent = append(p.sent, event)
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *fakePublisher) events() []messages.CartAbandoned {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]messages.CartAbandoned(nil), p.sent...)
+}
+
+func TestSweep(t *testing.T) {
+	const ttl = time.Hour
+	store := storage.NewMemoryStore()
+	pub := &fakePublisher{}
+	s := NewSweeper(store, ttl, time.Minute, pub)
+
+	idleEmpty := store.CreateCart(1)
+	idleWithItems := store.CreateCart(2)
+	if err := store.AddItem(idleWithItems, 5, 2); err != nil {
+		t.Fatal(err)
+	}
+	touched := store.CreateCart(3)
+	time.Sleep(time.Millisecond)
+	cutoff := time.Now().UTC()
+	time.Sleep(time.Millisecond)
+
+	// Activity after the cutoff keeps a cart, as does being created after it
+	if err := store.AddItem(touched, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	active := store.CreateCart(4)
+
+	s.sweep(cutoff.Add(ttl))
+
+	for _, id := range []int{idleEmpty, idleWithItems} {
+		if _, err := store.GetCart(id); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("idle cart %d still stored: %v", id, err)
+		}
+	}
+	for _, id := range []int{touched, active} {
+		if _, err := store.GetCart(id); err != nil {
+			t.Errorf("cart %d swept: %v", id, err)
+		}
+	}
+
+	// Only the cart that still held items is reported
+	events := pub.events()
+	if len(events) != 1 {
+		t.Fatalf("%d abandoned events, want 1: %+v", len(events), events)
+	}
+	event := events[0]
+	if event.Event != messages.CartAbandonedEvent || event.CartID != idleWithItems || event.CustomerID != 2 ||
+		len(event.Items) != 1 || event.Items[0].ProductID != 5 || event.Items[0].Quantity != 2 {
+		t.Errorf("abandoned event %+v", event)
+	}
+
+	// Nothing is idle long enough on a second pass
+	s.sweep(cutoff.Add(ttl))
+	if len(pub.events()) != 1 {
+		t.Errorf("second sweep published %d more events", len(pub.events())-1)
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	store := storage.NewMemoryStore()
+	s := NewSweeper(store, time.Nanosecond, time.Millisecond, &fakePublisher{})
+	cartID := store.CreateCart(1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		s.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := store.GetCart(cartID); errors.Is(err, storage.ErrNotFound) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Run did not sweep the idle cart")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+}
@@ -0,0 +1,156 @@
+package fulfillment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+	"common/metrics"
+	"common/tracing"
+
+	"shopping-cart-service/orders"
+)
+
+// StatusQueue is the cart service's durable queue on the order status
+// exchange, bound to every status.
+const StatusQueue = "orders.status.shopping-cart"
+
+var (
+	statusEvents        = expvar.NewInt("order_status_events")
+	statusEventsByState = metrics.NewCounter("shopping_cart_order_status_events_total",
+		"Warehouse order status events applied, by status.", "status")
+	statusEventsDropped = metrics.NewCounter("shopping_cart_order_status_events_dropped_total",
+		"Warehouse order status events dropped, by reason (unreadable, invalid, unknown_order).", "reason")
+)
+
+// Declare declares the order status exchange (with the same parameters
+// as warehouse-consumer) and binds StatusQueue to it.
+func Declare(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(
+		messages.OrderStatusExchange,
+		"topic",
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(
+		StatusQueue,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		nil,
+	); err != nil {
+		return err
+	}
+	return ch.QueueBind(StatusQueue, "#", messages.OrderStatusExchange, false, nil)
+}
+
+// Listener applies warehouse status events to order records.
+type Listener struct {
+	orders orders.Store
+	ch     *amqp.Channel
+}
+
+// NewListener creates a listener consuming StatusQueue on ch. The channel
+// should not be shared with publishers.
+func NewListener(store orders.Store, ch *amqp.Channel) *Listener {
+	return &Listener{orders: store, ch: ch}
+}
+
+// Run consumes status events until ctx is cancelled or the channel closes.
+func (l *Listener) Run(ctx context.Context) error {
+	deliveries, err := l.ch.Consume(
+		StatusQueue,
+		"shopping-cart-service",
+		false, // manual ack
+		false, // exclusive
+		false, // noLocal
+		false, // noWait
+		nil,
+	)
+	if err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case d, ok := <-deliveries:
+			if !ok {
+				return errors.New("status delivery channel closed")
+			}
+			l.handle(d)
+		}
+	}
+}
+
+// handle applies one event, in a consumer span continuing the trace of the
+// checkout that published the order. Unreadable events and events for
+// unknown orders are dropped; a failed store write is requeued.
+func (l *Listener) handle(d amqp.Delivery) {
+	ctx := tracing.Extract(context.Background(), d.Headers)
+	_, span := tracing.Start(ctx, StatusQueue+" process", tracing.KindConsumer)
+	span.SetAttribute("messaging.system", "rabbitmq")
+	span.SetAttribute("messaging.destination.name", StatusQueue)
+	defer span.End()
+
+	var event messages.OrderStatus
+	if err := json.Unmarshal(d.Body, &event); err != nil {
+		log.Printf("WARN: dropping unreadable order status event: %v", err)
+		statusEventsDropped.Inc("unreadable")
+		_ = d.Ack(false)
+		return
+	}
+	if err := event.Validate(); err != nil {
+		log.Printf("WARN: dropping invalid order status event: %v", err)
+		statusEventsDropped.Inc("invalid")
+		_ = d.Ack(false)
+		return
+	}
+	statusEvents.Add(1)
+	statusEventsByState.Inc(event.Status)
+	span.SetAttribute("order.id", event.OrderID)
+	span.SetAttribute("order.status", event.Status)
+
+	status := orders.Status(event.Status)
+	order, err := l.orders.Update(event.OrderID, func(o *orders.Order) bool {
+		if !o.Advance(status) {
+			return false
+		}
+		o.Backordered = nil
+		if status == orders.StatusBackordered {
+			o.Backordered = event.Backordered
+		}
+		o.UpdatedAt = time.Now().UTC()
+		return true
+	})
+	switch {
+	case errors.Is(err, orders.ErrNotFound):
+		// Orders kept in memory do not survive a restart, and finished
+		// orders are evicted after CART_ORDER_TTL
+		log.Printf("WARN: dropping status %s for unknown order %d (correlation %s)", event.Status, event.OrderID, event.CorrelationID)
+		statusEventsDropped.Inc("unknown_order")
+		span.SetAttribute("order.dropped", true)
+	case err != nil:
+		log.Printf("ERROR: failed to record status %s for order %d: %v", event.Status, event.OrderID, err)
+		span.SetError(err)
+		_ = d.Nack(false, true)
+		return
+	case order.Status == status:
+		log.Printf("Order %d is %s", event.OrderID, status)
+	}
+	_ = d.Ack(false)
+}
@@ -0,0 +1,81 @@
+package fulfillment
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+	"common/metrics"
+
+	"shopping-cart-service/orders"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeAcker records how a delivery was settled.
+type fakeAcker struct {
+	acked, nacked bool
+}
+
+func (a *fakeAcker) Ack(tag uint64, multiple bool) error {
+	a.acked = true
+	return nil
+}
+
+func (a *fakeAcker) Nack(tag uint64, multiple, requeue bool) error {
+	a.nacked = true
+	return nil
+}
+
+func (a *fakeAcker) Reject(tag uint64, requeue bool) error { return nil }
+
+func statusDelivery(t *testing.T, acker amqp.Acknowledger, orderID int, status string) amqp.Delivery {
+	t.Helper()
+	body, err := json.Marshal(messages.OrderStatus{
+		Event:      messages.OrderStatusEvent,
+		OrderID:    orderID,
+		Status:     status,
+		OccurredAt: time.Now().UTC(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{Acknowledger: acker, Body: body}
+}
+
+func TestHandle(t *testing.T) {
+	store := orders.NewMemoryStore()
+	if err := store.Save(orders.Order{OrderID: 1, Status: orders.StatusQueued}); err != nil {
+		t.Fatal(err)
+	}
+	l := NewListener(store, nil)
+
+	known := &fakeAcker{}
+	l.handle(statusDelivery(t, known, 1, messages.StatusReceived))
+	if order, _ := store.Get(1); !known.acked || order.Status != orders.StatusReceived {
+		t.Errorf("known order: acked %v, status %s; want acked and received", known.acked, order.Status)
+	}
+
+	unknown := &fakeAcker{}
+	l.handle(statusDelivery(t, unknown, 99, messages.StatusReceived))
+	if !unknown.acked || unknown.nacked {
+		t.Errorf("unknown order: acked %v, nacked %v; want dropped with an ack", unknown.acked, unknown.nacked)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if want := `shopping_cart_order_status_events_dropped_total{reason="unknown_order"} 1`; !strings.Contains(rec.Body.String(), want) {
+		t.Errorf("metrics do not contain %s", want)
+	}
+}
@@ -2,4 +2,9 @@ module shopping-cart-service
 
 go 1.21
 
-require github.com/rabbitmq/amqp091-go v1.10.0
+require (
+	common v0.0.0
+	github.com/rabbitmq/amqp091-go v1.10.0
+)
+
+replace common => ../common
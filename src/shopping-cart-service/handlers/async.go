@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"common/metrics"
+
+	"shopping-cart-service/orders"
+)
+
+var (
+	// errCheckoutBusy means the async checkout queue is full.
+	errCheckoutBusy = errors.New("checkout queue full")
+
+	// errCheckoutStopped means async checkout was stopped for shutdown.
+	errCheckoutStopped = errors.New("checkout stopped")
+)
+
+// checkoutJob is a pending order waiting for the async checkout pipeline.
+// The payment details only live here, never in the order store.
+type checkoutJob struct {
+	ctx     context.Context // detached from the request; carries its trace
+	order   orders.Order
+	payment paymentDetails
+}
+
+// asyncCheckout is the background pipeline of async checkout mode: a
+// bounded queue of pending orders drained by a fixed set of workers, each
+// running the checkout saga.
+type asyncCheckout struct {
+	jobs chan checkoutJob
+	wg   sync.WaitGroup
+
+	// mu guards stopped; enqueueCheckout holds it for reading while it
+	// sends, so jobs is never closed under a send.
+	mu      sync.RWMutex
+	stopped bool
+}
+
+// EnableAsyncCheckout switches checkout to async mode: POST .../checkout
+// records a pending order, queues it and answers 202 with a status URL,
+// and workers run authorization and publishing in the background. When
+// queueSize orders are already waiting, checkout answers 503.
+// Call it before serving requests.
+func (h *Handler) EnableAsyncCheckout(workers, queueSize int) {
+	if workers < 1 {
+		workers = 1
+	}
+	a := &asyncCheckout{jobs: make(chan checkoutJob, queueSize)}
+	metrics.NewGaugeFunc("shopping_cart_checkout_queue_depth",
+		"Orders waiting for the async checkout pipeline.",
+		func() float64 { return float64(len(a.jobs)) })
+	for i := 0; i < workers; i++ {
+		a.wg.Add(1)
+		go func() {
+			defer a.wg.Done()
+			for job := range a.jobs {
+				order, err := h.runCheckout(job.ctx, job.order, job.payment)
+				if err != nil {
+					log.Printf("Async checkout of order %d failed: %v", order.OrderID, err)
+					continue
+				}
+				log.Printf("Async checkout of order %d finished (status=%s)", order.OrderID, order.Status)
+			}
+		}()
+	}
+	h.async = a
+}
+
+// enqueueCheckout hands a pending order to the pipeline. It returns
+// errCheckoutBusy when the queue is full and errCheckoutStopped once
+// StopAsyncCheckout has been called.
+func (h *Handler) enqueueCheckout(job checkoutJob) error {
+	h.async.mu.RLock()
+	defer h.async.mu.RUnlock()
+
+	if h.async.stopped {
+		return errCheckoutStopped
+	}
+	select {
+	case h.async.jobs <- job:
+		return nil
+	default:
+		return errCheckoutBusy
+	}
+}
+
+// StopAsyncCheckout stops taking new orders and waits for the workers to
+// drain the queue, or for ctx to expire. Orders still queued then stay
+// pending and are failed by RecoverCheckouts on the next start. Call it
+// after the HTTP server has shut down, with a context of its own: a
+// checkout that outlived the server shutdown may still be enqueueing.
+func (h *Handler) StopAsyncCheckout(ctx context.Context) {
+	if h.async == nil {
+		return
+	}
+	h.async.mu.Lock()
+	if h.async.stopped {
+		h.async.mu.Unlock()
+		return
+	}
+	h.async.stopped = true
+	close(h.async.jobs)
+	h.async.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		h.async.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("WARN: async checkout stopped with %d orders still queued", len(h.async.jobs))
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"shopping-cart-service/orders"
+)
+
+// TestStopAsyncCheckoutRace stops the pipeline while checkouts are still
+// being enqueued. Late enqueues must fail with errCheckoutStopped instead
+// of sending on the closed queue. Run with -race.
+func TestStopAsyncCheckoutRace(t *testing.T) {
+	// An unbuffered queue with no workers: every enqueue before the stop
+	// finds it busy, so no checkout ever runs.
+	h := &Handler{async: &asyncCheckout{jobs: make(chan checkoutJob)}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				err := h.enqueueCheckout(checkoutJob{ctx: context.Background(), order: orders.Order{OrderID: j}})
+				if errors.Is(err, errCheckoutStopped) {
+					return
+				}
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	h.StopAsyncCheckout(ctx)
+	h.StopAsyncCheckout(ctx) // stopping twice is a no-op
+	wg.Wait()
+
+	if err := h.enqueueCheckout(checkoutJob{}); !errors.Is(err, errCheckoutStopped) {
+		t.Fatalf("enqueue after stop: err = %v, want errCheckoutStopped", err)
+	}
+}
@@ -1,18 +1,31 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 
+	"common/messages"
+	"common/tracing"
+
+	"shopping-cart-service/limits"
 	"shopping-cart-service/models"
+	"shopping-cart-service/orders"
+	"shopping-cart-service/pricing"
+	"shopping-cart-service/products"
+	"shopping-cart-service/promotions"
+	"shopping-cart-service/shipping"
 	"shopping-cart-service/storage"
 )
 
@@ -23,44 +36,103 @@ type ErrorResponse struct {
 	Details *string `json:"details,omitempty"`
 }
 
+// cartResponse is the body of GET /shopping-carts/{id}.
+type cartResponse struct {
+	ShoppingCartID int       `json:"shopping_cart_id"`
+	CustomerID     int       `json:"customer_id"`
+	CouponCode     string    `json:"coupon_code,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	pricing.Quote
+}
+
+// checkoutResponse is the body of a successful checkout. Status and
+// StatusURL are only set by async checkout.
+type checkoutResponse struct {
+	OrderID   int           `json:"order_id"`
+	Status    orders.Status `json:"status,omitempty"`
+	StatusURL string        `json:"status_url,omitempty"`
+	Discount  int64         `json:"discount,omitempty"`
+	Shipping  int64         `json:"shipping"`
+	Total     int64         `json:"total"`
+	Currency  string        `json:"currency"`
+}
+
+// CorrelationIDHeader carries the correlation ID across HTTP hops.
+// It is read from the incoming checkout request (or generated), forwarded
+// to the CCA, and stamped on the published order message.
+const CorrelationIDHeader = "X-Correlation-ID"
+
 // Handler holds dependencies for the shopping cart service:
 // - storage layer
 // - credit card authorizer endpoint
+// - product service client, pricer and promotions (for prices, discounts and item snapshots)
+// - order store (checkout saga state)
 // - RabbitMQ channel and queue info
 type Handler struct {
-	store       storage.Store
-	ccaURL      string
-	nextOrderID int
-
-	mqChannel *amqp.Channel
+	store              storage.Store
+	ccaURL             string
+	ccaClient          *http.Client
+	products           *products.Client
+	pricer             *pricing.Pricer
+	promotions         *promotions.Engine
+	limits             limits.Rules
+	oneCartPerCustomer bool
+	orders             orders.Store
+	async              *asyncCheckout // nil in sync checkout mode
+
+	mqChannel publisher
 	queueName string
 }
 
-// OrderMessage represents the payload sent to RabbitMQ when an order is created.
-type OrderMessage struct {
-	OrderID int               `json:"order_id"`
-	CartID  int               `json:"cart_id"`
-	Items   []models.CartItem `json:"items"`
+// publisher is the part of *amqp.Channel the handler publishes orders with.
+type publisher interface {
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error)
 }
 
-// NewHandler constructs the handler with storage, CCA URL, and RabbitMQ components.
-func NewHandler(store storage.Store, ccaURL string, ch *amqp.Channel, queueName string) *Handler {
+// NewHandler constructs the handler with storage, CCA URL, product client, pricer, promotions, order store and RabbitMQ components.
+// cartLimits bounds line quantities and cart size. With oneCartPerCustomer, creating a cart
+// returns the customer's open cart if they have one. ch should be in confirm mode so that
+// checkout waits for the broker to take each order.
+func NewHandler(store storage.Store, ccaURL string, productClient *products.Client, pricer *pricing.Pricer, promoEngine *promotions.Engine, cartLimits limits.Rules, oneCartPerCustomer bool, orderStore orders.Store, ch *amqp.Channel, queueName string) *Handler {
 	return &Handler{
-		store:       store,
-		ccaURL:      ccaURL,
-		nextOrderID: 1,
-		mqChannel:   ch,
-		queueName:   queueName,
+		store:              store,
+		ccaURL:             ccaURL,
+		ccaClient:          &http.Client{Timeout: 5 * time.Second, Transport: tracing.Transport(nil)},
+		products:           productClient,
+		pricer:             pricer,
+		promotions:         promoEngine,
+		limits:             cartLimits,
+		oneCartPerCustomer: oneCartPerCustomer,
+		orders:             orderStore,
+		mqChannel:          ch,
+		queueName:          queueName,
 	}
 }
 
+// Routes lists the paths served under the subtree patterns registered by
+// RegisterRoutes, for naming requests in metrics and traces.
+var Routes = []string{
+	"/shopping-carts/{id}",
+	"/shopping-carts/{id}/addItem",
+	"/shopping-carts/{id}/applyCoupon",
+	"/shopping-carts/{id}/setShippingMethod",
+	"/shopping-carts/{id}/merge",
+	"/shopping-carts/{id}/checkout",
+	"/customers/{id}/cart",
+	"/orders/{id}",
+}
+
 // RegisterRoutes maps the HTTP endpoints to handler functions.
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/shopping-cart", h.handleCreateCart)
 	mux.HandleFunc("/shopping-carts/", h.handleCartOperations)
+	mux.HandleFunc("/customers/", h.handleCustomerCart)
+	mux.HandleFunc("/orders/", h.handleGetOrder)
 }
 
-// handleCreateCart creates a new shopping cart.
+// handleCreateCart creates a new shopping cart. A missing customer_id
+// creates a guest cart, which can later be merged into a customer's cart.
 func (h *Handler) handleCreateCart(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
@@ -76,23 +148,79 @@ func (h *Handler) handleCreateCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if payload.CustomerID < 1 {
-		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "customer_id must be a positive integer")
+	if payload.CustomerID < 0 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "customer_id must be a positive integer, or 0 or omitted for a guest cart")
 		return
 	}
 
-	cartID := h.store.CreateCart(payload.CustomerID)
+	// Reuse the customer's open cart when configured; 200 instead of 201
+	status := http.StatusCreated
+	var cartID int
+	if h.oneCartPerCustomer && payload.CustomerID > 0 {
+		var created bool
+		cartID, created = h.store.GetOrCreateCart(payload.CustomerID)
+		if !created {
+			status = http.StatusOK
+		}
+	} else {
+		cartID = h.store.CreateCart(payload.CustomerID)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(map[string]int{"shopping_cart_id": cartID})
 }
 
-// handleCartOperations dispatches operations like addItem and checkout.
+// handleCustomerCart serves GET /customers/{id}/cart, the customer's open cart.
+func (h *Handler) handleCustomerCart(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/customers/")
+	if !strings.HasSuffix(path, "/cart") {
+		h.writeError(w, http.StatusNotFound, "NOT_FOUND", "Endpoint not found")
+		return
+	}
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	customerID, err := strconv.Atoi(strings.TrimSuffix(path, "/cart"))
+	if err != nil || customerID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid customer ID")
+		return
+	}
+
+	cart, err := h.store.CustomerCart(customerID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Customer has no open shopping cart")
+			return
+		}
+		log.Printf("ERROR: failed to get customer cart: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve cart")
+		return
+	}
+
+	quote, err := h.pricer.Quote(r.Context(), *cart)
+	if err != nil {
+		h.writePricingError(w, err)
+		return
+	}
+
+	h.writeCart(w, cart, quote)
+}
+
+// handleCartOperations dispatches operations like addItem, applyCoupon, setShippingMethod, merge and checkout.
 func (h *Handler) handleCartOperations(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/shopping-carts/")
 
-	if strings.HasSuffix(path, "/addItem") {
+	if !strings.Contains(path, "/") {
+		if r.Method != http.MethodGet {
+			h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		h.handleGetCart(w, r, path)
+
+	} else if strings.HasSuffix(path, "/addItem") {
 		idStr := strings.TrimSuffix(path, "/addItem")
 		if r.Method != http.MethodPost {
 			h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
@@ -100,6 +228,30 @@ func (h *Handler) handleCartOperations(w http.ResponseWriter, r *http.Request) {
 		}
 		h.handleAddItem(w, r, idStr)
 
+	} else if strings.HasSuffix(path, "/applyCoupon") {
+		idStr := strings.TrimSuffix(path, "/applyCoupon")
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		h.handleApplyCoupon(w, r, idStr)
+
+	} else if strings.HasSuffix(path, "/setShippingMethod") {
+		idStr := strings.TrimSuffix(path, "/setShippingMethod")
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		h.handleSetShippingMethod(w, r, idStr)
+
+	} else if strings.HasSuffix(path, "/merge") {
+		idStr := strings.TrimSuffix(path, "/merge")
+		if r.Method != http.MethodPost {
+			h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+			return
+		}
+		h.handleMerge(w, r, idStr)
+
 	} else if strings.HasSuffix(path, "/checkout") {
 		idStr := strings.TrimSuffix(path, "/checkout")
 		if r.Method != http.MethodPost {
@@ -140,12 +292,79 @@ func (h *Handler) handleAddItem(w http.ResponseWriter, r *http.Request, idStr st
 		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "quantity must be a positive integer")
 		return
 	}
+	// Reject oversized quantities before adding them to what is in the cart, so the sum cannot overflow
+	if limit := h.limits.MaxLineQuantity; limit > 0 && payload.Quantity > limit {
+		h.writeLimitError(w, fmt.Errorf("%w: quantity %d exceeds %d per line", limits.ErrLineQuantity, payload.Quantity, limit))
+		return
+	}
+
+	cart, err := h.store.GetCart(cartID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to get cart: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve cart")
+		return
+	}
+
+	// The product must exist, and a cart only holds products in one currency
+	product, err := h.products.GetProduct(r.Context(), payload.ProductID)
+	if err != nil {
+		h.writePricingError(w, err)
+		return
+	}
+	if len(cart.Items) > 0 {
+		existing, err := h.products.GetProduct(r.Context(), cart.Items[0].ProductID)
+		if err != nil {
+			h.writePricingError(w, err)
+			return
+		}
+		if existing.Currency != product.Currency {
+			h.writeError(w, http.StatusBadRequest, "MIXED_CURRENCY",
+				fmt.Sprintf("Cart is priced in %s, product %d is priced in %s", existing.Currency, product.ProductID, product.Currency))
+			return
+		}
+	}
+
+	// Check the line as it will be after the add. Concurrent adds can still
+	// overshoot; checkout checks the limits again.
+	quantity, lines := payload.Quantity, len(cart.Items)+1
+	for _, item := range cart.Items {
+		if item.ProductID == payload.ProductID {
+			if quantity > math.MaxInt-item.Quantity {
+				h.writeLimitError(w, fmt.Errorf("%w: product %d", storage.ErrQuantityOverflow, product.ProductID))
+				return
+			}
+			quantity += item.Quantity
+			lines--
+			break
+		}
+	}
+	if err := h.limits.CheckLine(product, quantity); err != nil {
+		h.writeLimitError(w, err)
+		return
+	}
+	if err := h.limits.CheckLines(lines); err != nil {
+		h.writeLimitError(w, err)
+		return
+	}
+	// Quantity limits may be disabled, so also bound what the line costs
+	if _, err := pricing.LineTotal(product.Price, quantity); err != nil {
+		h.writePricingError(w, err)
+		return
+	}
 
 	if err := h.store.AddItem(cartID, payload.ProductID, payload.Quantity); err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
 			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
 			return
 		}
+		if errors.Is(err, storage.ErrQuantityOverflow) {
+			h.writeLimitError(w, err)
+			return
+		}
 		log.Printf("ERROR: failed to add item: %v", err)
 		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to add item")
 		return
@@ -154,24 +373,52 @@ func (h *Handler) handleAddItem(w http.ResponseWriter, r *http.Request, idStr st
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// handleCheckout authorizes payment and publishes the order to RabbitMQ.
-func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request, idStr string) {
+// handleGetCart returns a cart with its items priced and totals computed.
+func (h *Handler) handleGetCart(w http.ResponseWriter, r *http.Request, idStr string) {
 	cartID, err := strconv.Atoi(idStr)
 	if err != nil || cartID < 1 {
 		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid shopping cart ID")
 		return
 	}
 
-	var payload struct {
-		CreditCardNumber string `json:"credit_card_number"`
+	cart, err := h.store.GetCart(cartID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to get cart: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve cart")
+		return
 	}
 
+	quote, err := h.pricer.Quote(r.Context(), *cart)
+	if err != nil {
+		h.writePricingError(w, err)
+		return
+	}
+
+	h.writeCart(w, cart, quote)
+}
+
+// handleApplyCoupon sets the coupon of a cart after checking it can be
+// used, and returns the repriced cart. An empty code removes the coupon.
+func (h *Handler) handleApplyCoupon(w http.ResponseWriter, r *http.Request, idStr string) {
+	cartID, err := strconv.Atoi(idStr)
+	if err != nil || cartID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid shopping cart ID")
+		return
+	}
+
+	var payload struct {
+		Code string `json:"code"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
 		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
 		return
 	}
+	code := strings.TrimSpace(payload.Code)
 
-	// Retrieve the shopping cart
 	cart, err := h.store.GetCart(cartID)
 	if err != nil {
 		if errors.Is(err, storage.ErrNotFound) {
@@ -183,103 +430,269 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request, idStr s
 		return
 	}
 
-	if len(cart.Items) == 0 {
-		h.writeError(w, http.StatusBadRequest, "EMPTY_CART", "Cannot checkout empty cart")
+	candidate := *cart
+	candidate.CouponCode = code
+	quote, err := h.pricer.Quote(r.Context(), candidate)
+	if err != nil {
+		h.writePricingError(w, err)
 		return
 	}
 
-	// Contact CCA for payment authorization
-	authorized, err := h.authorizePayment(payload.CreditCardNumber)
+	if err := h.store.SetCoupon(cartID, code); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to set coupon: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to apply coupon")
+		return
+	}
+
+	h.writeCart(w, &candidate, quote)
+}
+
+// handleSetShippingMethod sets the shipping method of a cart and returns
+// the repriced cart. An empty method selects the default.
+func (h *Handler) handleSetShippingMethod(w http.ResponseWriter, r *http.Request, idStr string) {
+	cartID, err := strconv.Atoi(idStr)
+	if err != nil || cartID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid shopping cart ID")
+		return
+	}
+
+	var payload struct {
+		Method string `json:"method"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
+		return
+	}
+	method := strings.ToLower(strings.TrimSpace(payload.Method))
+
+	cart, err := h.store.GetCart(cartID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to get cart: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve cart")
+		return
+	}
+
+	candidate := *cart
+	candidate.ShippingMethod = method
+	quote, err := h.pricer.Quote(r.Context(), candidate)
 	if err != nil {
-		// 400 场景（格式错、其他异常） → INVALID_CARD
-		h.writeError(w, http.StatusBadRequest, "INVALID_CARD", err.Error())
+		h.writePricingError(w, err)
 		return
 	}
-	if !authorized {
-		// 402 场景（支付拒绝）
-		h.writeError(w, http.StatusPaymentRequired, "PAYMENT_DECLINED", "Payment was declined")
+
+	if err := h.store.SetShippingMethod(cartID, method); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to set shipping method: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to set shipping method")
 		return
 	}
 
-	// Generate a new order ID
-	orderID := h.nextOrderID
-	h.nextOrderID++
+	h.writeCart(w, &candidate, quote)
+}
 
-	// Create the message payload to send to RabbitMQ
-	msg := OrderMessage{
-		OrderID: orderID,
-		CartID:  cartID,
-		Items:   cart.Items,
+// handleMerge merges the guest cart given as source_cart_id into this
+// cart, adding quantities of products in both, and returns the repriced cart.
+func (h *Handler) handleMerge(w http.ResponseWriter, r *http.Request, idStr string) {
+	cartID, err := strconv.Atoi(idStr)
+	if err != nil || cartID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid shopping cart ID")
+		return
 	}
 
-	body, err := json.Marshal(msg)
+	var payload struct {
+		SourceCartID int `json:"source_cart_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
+		return
+	}
+	if payload.SourceCartID < 1 || payload.SourceCartID == cartID {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "source_cart_id must be another shopping cart ID")
+		return
+	}
+
+	target, err := h.store.GetCart(cartID)
+	var source *models.ShoppingCart
+	if err == nil {
+		source, err = h.store.GetCart(payload.SourceCartID)
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to get cart: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve cart")
+		return
+	}
+
+	// Check the cart as the merge will leave it: the combined quantities
+	// must be within the limits, like an add, and the cart still priceable,
+	// e.g. in a single currency. Concurrent changes can still overshoot;
+	// checkout checks the limits again.
+	merged := *target
+	merged.Items, err = mergeItems(target.Items, source.Items)
 	if err != nil {
-		log.Printf("ERROR: failed to marshal order message: %v", err)
-		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to enqueue order")
+		h.writeLimitError(w, err)
+		return
+	}
+	quote, err := h.pricer.Quote(r.Context(), merged)
+	if err != nil {
+		h.writePricingError(w, err)
+		return
+	}
+	if err := h.checkLimits(quote); err != nil {
+		h.writeLimitError(w, err)
 		return
 	}
 
-	// Publish the message to RabbitMQ (fire-and-forget)
-	if err := h.mqChannel.Publish(
-		"",
-		h.queueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		},
-	); err != nil {
-		log.Printf("ERROR: failed to publish order to RabbitMQ: %v", err)
-		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to enqueue order")
+	if err := h.store.MergeCarts(cartID, payload.SourceCartID); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrQuantityOverflow):
+			h.writeLimitError(w, err)
+		case errors.Is(err, storage.ErrNotFound):
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+		case errors.Is(err, storage.ErrCustomerMismatch):
+			h.writeError(w, http.StatusConflict, "CART_CUSTOMER_MISMATCH", "Source cart belongs to another customer")
+		default:
+			log.Printf("ERROR: failed to merge carts: %v", err)
+			h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to merge carts")
+		}
 		return
 	}
 
-	// Clear the cart after successful order submission
-	_ = h.store.ClearCart(cartID)
+	h.handleGetCart(w, r, idStr)
+}
 
-	log.Printf("Order %d created for cart %d with %d items", orderID, cartID, len(cart.Items))
+// mergeItems returns the lines of target with those of source added, as
+// the store merges them, or storage.ErrQuantityOverflow.
+func mergeItems(target, source []models.CartItem) ([]models.CartItem, error) {
+	items := append([]models.CartItem(nil), target...)
+	for _, add := range source {
+		found := false
+		for i, item := range items {
+			if item.ProductID == add.ProductID {
+				if add.Quantity > math.MaxInt-item.Quantity {
+					return nil, fmt.Errorf("%w: product %d", storage.ErrQuantityOverflow, add.ProductID)
+				}
+				items[i].Quantity += add.Quantity
+				found = true
+				break
+			}
+		}
+		if !found {
+			items = append(items, add)
+		}
+	}
+	return items, nil
+}
 
+// writeCart writes a priced cart as the JSON response body.
+func (h *Handler) writeCart(w http.ResponseWriter, cart *models.ShoppingCart, quote pricing.Quote) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(map[string]int{"order_id": orderID})
+	_ = json.NewEncoder(w).Encode(cartResponse{
+		ShoppingCartID: cart.ShoppingCartID,
+		CustomerID:     cart.CustomerID,
+		CouponCode:     cart.CouponCode,
+		CreatedAt:      cart.CreatedAt,
+		UpdatedAt:      cart.UpdatedAt,
+		Quote:          quote,
+	})
+}
+
+// orderItems converts priced cart lines into order items, attaching the
+// SKU and weight of the product as it was priced.
+func orderItems(quote pricing.Quote) []messages.OrderItem {
+	out := make([]messages.OrderItem, 0, len(quote.Lines))
+	for _, line := range quote.Lines {
+		out = append(out, messages.OrderItem{
+			ProductID: line.ProductID,
+			Quantity:  line.Quantity,
+			SKU:       line.Product.SKU,
+			Weight:    line.Product.Weight,
+		})
+	}
+	return out
+}
+
+// promotionCode returns the code of the promotion applied to quote, if any.
+func promotionCode(quote pricing.Quote) string {
+	if len(quote.Discounts) == 0 {
+		return ""
+	}
+	return quote.Discounts[0].Code
+}
+
+// checkLimits checks every line of a priced cart and the number of lines.
+func (h *Handler) checkLimits(quote pricing.Quote) error {
+	for _, line := range quote.Lines {
+		if err := h.limits.CheckLine(line.Product, line.Quantity); err != nil {
+			return err
+		}
+	}
+	return h.limits.CheckLines(len(quote.Lines))
+}
+
+// writeLimitError maps cart limit errors to responses.
+func (h *Handler) writeLimitError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, limits.ErrLineQuantity), errors.Is(err, storage.ErrQuantityOverflow):
+		h.writeError(w, http.StatusBadRequest, "QUANTITY_LIMIT_EXCEEDED", err.Error())
+	case errors.Is(err, limits.ErrProductLimit):
+		h.writeError(w, http.StatusBadRequest, "PRODUCT_LIMIT_EXCEEDED", err.Error())
+	case errors.Is(err, limits.ErrTooManyLines):
+		h.writeError(w, http.StatusBadRequest, "TOO_MANY_ITEMS", err.Error())
+	default:
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+	}
+}
+
+// writePricingError maps product lookup, pricing, coupon and shipping errors to responses.
+func (h *Handler) writePricingError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, products.ErrNotFound):
+		h.writeError(w, http.StatusNotFound, "PRODUCT_NOT_FOUND", err.Error())
+	case errors.Is(err, pricing.ErrMixedCurrency):
+		h.writeError(w, http.StatusBadRequest, "MIXED_CURRENCY", err.Error())
+	case errors.Is(err, pricing.ErrAmountTooLarge):
+		h.writeError(w, http.StatusBadRequest, "AMOUNT_TOO_LARGE", err.Error())
+	case errors.Is(err, pricing.ErrWeightTooLarge):
+		h.writeError(w, http.StatusBadRequest, "WEIGHT_TOO_LARGE", err.Error())
+	case errors.Is(err, promotions.ErrUnknownCode):
+		h.writeError(w, http.StatusNotFound, "COUPON_NOT_FOUND", err.Error())
+	case errors.Is(err, promotions.ErrNotActive):
+		h.writeError(w, http.StatusBadRequest, "COUPON_NOT_ACTIVE", err.Error())
+	case errors.Is(err, promotions.ErrNotApplicable):
+		h.writeError(w, http.StatusBadRequest, "COUPON_NOT_APPLICABLE", err.Error())
+	case errors.Is(err, promotions.ErrUsageLimit):
+		h.writeError(w, http.StatusConflict, "COUPON_USAGE_LIMIT_REACHED", err.Error())
+	case errors.Is(err, shipping.ErrUnknownMethod):
+		h.writeError(w, http.StatusBadRequest, "UNKNOWN_SHIPPING_METHOD", err.Error())
+	case errors.Is(err, shipping.ErrOverweight):
+		h.writeError(w, http.StatusBadRequest, "SHIPPING_UNAVAILABLE", err.Error())
+	default:
+		log.Printf("ERROR: product lookup failed: %v", err)
+		h.writeError(w, http.StatusServiceUnavailable, "PRODUCT_SERVICE_UNAVAILABLE", "Failed to retrieve product information")
+	}
 }
 
-// authorizePayment calls the credit card authorizer service.
-//
-// 协议和 OpenAPI 对齐：
-//   - 200 OK  → 授权成功
-//   - 400 Bad Request → 卡号格式错误
-//   - 402 Payment Required → 授权被拒
-func (h *Handler) authorizePayment(cardNumber string) (bool, error) {
-    reqBody, _ := json.Marshal(map[string]string{
-        "credit_card_number": cardNumber,
-    })
-
-    // ★ 关键改动：不再自己拼路径，直接用环境变量里的完整 URL
-    resp, err := http.Post(h.ccaURL, "application/json", bytes.NewBuffer(reqBody))
-    if err != nil {
-        return false, fmt.Errorf("failed to contact payment service")
-    }
-    defer resp.Body.Close()
-
-    // ★ 为了 debug 更清楚，把 status code 带进错误信息里
-    if resp.StatusCode == http.StatusBadRequest {
-        return false, fmt.Errorf("invalid credit card format")
-    }
-
-    if resp.StatusCode == http.StatusPaymentRequired {
-        // 402 → 拒绝
-        return false, nil
-    }
-
-    if resp.StatusCode == http.StatusOK {
-        // 200 → 授权通过
-        return true, nil
-    }
-
-    // 其他情况，一律认为是“payment service 返回了意外状态码”
-    return false, fmt.Errorf("unexpected response from payment service (status %d)", resp.StatusCode)
+// newCorrelationID returns a random 128-bit hex identifier.
+func newCorrelationID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
 }
 
 // writeError writes a standardized error JSON response.
@@ -287,4 +700,16 @@ func (h *Handler) writeError(w http.ResponseWriter, status int, code, message st
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: code, Message: message})
-}
\ No newline at end of file
+}
+
+// writeErrorDetails writes a standardized error JSON response with details.
+// Empty details are omitted.
+func (h *Handler) writeErrorDetails(w http.ResponseWriter, status int, code, message, details string) {
+	resp := ErrorResponse{Error: code, Message: message}
+	if details != "" {
+		resp.Details = &details
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
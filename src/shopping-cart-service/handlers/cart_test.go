@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"testing"
+
+	"shopping-cart-service/limits"
+	"shopping-cart-service/models"
+	"shopping-cart-service/storage"
+)
+
+// TestMergeLimits merges a guest cart whose items are each within the
+// limits but exceed them combined with the target's. The merge must be
+// rejected and leave both carts as they were.
+func TestMergeLimits(t *testing.T) {
+	rules := limits.Rules{MaxLineQuantity: 5, MaxLines: 2}
+	tests := []struct {
+		name   string
+		rules  limits.Rules
+		target []models.CartItem
+		source []models.CartItem
+		code   string
+	}{
+		{
+			name:   "line quantity",
+			rules:  rules,
+			target: []models.CartItem{{ProductID: 1, Quantity: 3}},
+			source: []models.CartItem{{ProductID: 1, Quantity: 3}},
+			code:   "QUANTITY_LIMIT_EXCEEDED",
+		},
+		{
+			name:   "lines",
+			rules:  rules,
+			target: []models.CartItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 1}},
+			source: []models.CartItem{{ProductID: 3, Quantity: 1}},
+			code:   "TOO_MANY_ITEMS",
+		},
+		{
+			name:   "max per order",
+			rules:  rules,
+			target: []models.CartItem{{ProductID: 9, Quantity: 2}},
+			source: []models.CartItem{{ProductID: 9, Quantity: 2}},
+			code:   "PRODUCT_LIMIT_EXCEEDED",
+		},
+		{
+			name:   "quantity overflow",
+			rules:  limits.Rules{},
+			target: []models.CartItem{{ProductID: 1, Quantity: math.MaxInt}},
+			source: []models.CartItem{{ProductID: 1, Quantity: 1}},
+			code:   "QUANTITY_LIMIT_EXCEEDED",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemoryStore()
+			h, mux, _, _, _ := testHandler(t, store)
+			h.limits = tt.rules
+
+			target, source := store.CreateCart(7), store.CreateCart(0)
+			for _, item := range tt.target {
+				mustAdd(t, store, target, item)
+			}
+			for _, item := range tt.source {
+				mustAdd(t, store, source, item)
+			}
+
+			rec := do(mux, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/merge", target),
+				fmt.Sprintf(`{"source_cart_id":%d}`, source))
+			var body struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+			if rec.Code != http.StatusBadRequest || body.Error != tt.code {
+				t.Fatalf("merge = %d %s, want 400 %s", rec.Code, rec.Body, tt.code)
+			}
+
+			for id, want := range map[int][]models.CartItem{target: tt.target, source: tt.source} {
+				cart, err := store.GetCart(id)
+				if err != nil {
+					t.Fatalf("cart %d after the rejected merge: %v", id, err)
+				}
+				if fmt.Sprint(cart.Items) != fmt.Sprint(want) {
+					t.Errorf("cart %d items = %v, want %v", id, cart.Items, want)
+				}
+			}
+		})
+	}
+}
+
+// TestMergeWithinLimits merges carts whose combined quantities just fit.
+func TestMergeWithinLimits(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h, mux, _, _, _ := testHandler(t, store)
+	h.limits = limits.Rules{MaxLineQuantity: 5, MaxLines: 2}
+
+	target, source := store.CreateCart(7), store.CreateCart(0)
+	mustAdd(t, store, target, models.CartItem{ProductID: 1, Quantity: 3})
+	mustAdd(t, store, source, models.CartItem{ProductID: 1, Quantity: 2})
+	mustAdd(t, store, source, models.CartItem{ProductID: 9, Quantity: 3})
+
+	rec := do(mux, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/merge", target),
+		fmt.Sprintf(`{"source_cart_id":%d}`, source))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("merge = %d %s, want 200", rec.Code, rec.Body)
+	}
+	cart, err := store.GetCart(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []models.CartItem{{ProductID: 1, Quantity: 5}, {ProductID: 9, Quantity: 3}}
+	if fmt.Sprint(cart.Items) != fmt.Sprint(want) {
+		t.Errorf("merged items = %v, want %v", cart.Items, want)
+	}
+}
+
+func mustAdd(t *testing.T, store storage.Store, cartID int, item models.CartItem) {
+	t.Helper()
+	if err := store.AddItem(cartID, item.ProductID, item.Quantity); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+	"common/metrics"
+	"common/tracing"
+
+	"shopping-cart-service/orders"
+	"shopping-cart-service/storage"
+)
+
+// errCheckoutFailed means a step after payment authorization failed and
+// the checkout was rolled back.
+var errCheckoutFailed = errors.New("checkout failed")
+
+// errPublishUnconfirmed means the broker did not confirm an order message
+// in time; the message may or may not be on the queue.
+var errPublishUnconfirmed = errors.New("order publish not confirmed")
+
+// publishConfirmTimeout bounds the wait for the broker to confirm an
+// order message.
+const publishConfirmTimeout = 5 * time.Second
+
+var (
+	checkoutsTotal = metrics.NewCounter("shopping_cart_checkouts_total",
+		"Checkout payment authorizations by result (authorized, declined, error).", "result")
+	checkoutRollbacks = metrics.NewCounter("shopping_cart_checkout_rollbacks_total",
+		"Checkouts rolled back after the payment was authorized.")
+	ordersPublished = metrics.NewCounter("shopping_cart_orders_published_total",
+		"Order messages published to the orders queue.")
+)
+
+// handleCheckout prices the cart, records a pending order and runs the
+// checkout saga (see runCheckout), or in async mode queues it for the
+// background pipeline and answers 202.
+func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request, idStr string) {
+	cartID, err := strconv.Atoi(idStr)
+	if err != nil || cartID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid shopping cart ID")
+		return
+	}
+
+	var payload paymentDetails
+
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid JSON payload")
+		return
+	}
+
+	if err := payload.validate(); err != nil {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", err.Error())
+		return
+	}
+
+	// Retrieve the shopping cart
+	cart, err := h.store.GetCart(cartID)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "CART_NOT_FOUND", "Shopping cart not found")
+			return
+		}
+		log.Printf("ERROR: failed to get cart: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve cart")
+		return
+	}
+
+	if len(cart.Items) == 0 {
+		h.writeError(w, http.StatusBadRequest, "EMPTY_CART", "Cannot checkout empty cart")
+		return
+	}
+	if cart.CustomerID == 0 {
+		h.writeError(w, http.StatusBadRequest, "GUEST_CART", "Merge the guest cart into a customer cart before checkout")
+		return
+	}
+
+	// Price the cart with current product prices and its coupon
+	quote, err := h.pricer.Quote(r.Context(), *cart)
+	if err != nil {
+		h.writePricingError(w, err)
+		return
+	}
+
+	// Re-check limits against current product rules; the cart may have
+	// been merged or the rules changed since the items were added
+	if err := h.checkLimits(quote); err != nil {
+		h.writeLimitError(w, err)
+		return
+	}
+
+	correlationID := r.Header.Get(CorrelationIDHeader)
+	if correlationID == "" {
+		correlationID = newCorrelationID()
+	}
+	w.Header().Set(CorrelationIDHeader, correlationID)
+
+	// The order message is built up front and stored with the order, so a
+	// checkout resumed after a restart publishes exactly what was priced.
+	now := time.Now().UTC()
+	orderID := h.orders.NextID()
+	msg := messages.OrderMessage{
+		SchemaVersion:  messages.SchemaVersion,
+		OrderID:        orderID,
+		CartID:         cartID,
+		CustomerID:     cart.CustomerID,
+		CorrelationID:  correlationID,
+		CreatedAt:      now,
+		Items:          orderItems(quote),
+		Currency:       quote.Currency,
+		Subtotal:       quote.Subtotal,
+		Discount:       quote.Discount,
+		Tax:            quote.Tax,
+		Shipping:       quote.Shipping,
+		ShippingMethod: quote.ShippingMethod,
+		Total:          quote.Total,
+		PromotionCode:  promotionCode(quote),
+	}
+	if err := msg.Validate(); err != nil {
+		log.Printf("ERROR: order message failed validation: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create order")
+		return
+	}
+
+	// Take a use of the coupon now so concurrent checkouts cannot exceed
+	// its usage limit; runCheckout gives it back unless the order is queued.
+	if cart.CouponCode != "" {
+		if err := h.promotions.Redeem(cart.CouponCode, now); err != nil {
+			h.writePricingError(w, err)
+			return
+		}
+	}
+
+	order := orders.Order{
+		OrderID:        orderID,
+		CartID:         cartID,
+		CustomerID:     cart.CustomerID,
+		Status:         orders.StatusPending,
+		CorrelationID:  correlationID,
+		IdempotencyKey: newCorrelationID(),
+		Items:          cart.Items,
+		CouponCode:     cart.CouponCode,
+		ShippingMethod: cart.ShippingMethod,
+		Message:        msg,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if err := h.orders.Save(order); err != nil {
+		log.Printf("ERROR: failed to save order %d: %v", orderID, err)
+		if cart.CouponCode != "" {
+			h.promotions.Release(cart.CouponCode)
+		}
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to create order")
+		return
+	}
+
+	// Async mode: answer now and let the pipeline run the saga
+	if h.async != nil {
+		if err := h.enqueueCheckout(checkoutJob{ctx: tracing.Detach(r.Context()), order: order, payment: payload}); err != nil {
+			order.Status = orders.StatusFailed
+			order.FailureReason = err.Error()
+			h.saveOrder(&order)
+			if cart.CouponCode != "" {
+				h.promotions.Release(cart.CouponCode)
+			}
+			message := "Too many checkouts in progress, retry later"
+			if errors.Is(err, errCheckoutStopped) {
+				message = "Service is shutting down, retry later"
+			}
+			h.writeError(w, http.StatusServiceUnavailable, "CHECKOUT_BUSY", message)
+			return
+		}
+
+		statusURL := orderStatusURL(orderID)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", statusURL)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(checkoutResponse{
+			OrderID:   orderID,
+			Status:    orders.StatusPending,
+			StatusURL: statusURL,
+			Discount:  quote.Discount,
+			Shipping:  quote.Shipping,
+			Total:     quote.Total,
+			Currency:  quote.Currency,
+		})
+		return
+	}
+
+	order, err = h.runCheckout(r.Context(), order, payload)
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrCartChanged):
+			// 同一个购物车的另一次 checkout 先拿走了这些商品；授权已经 void
+			h.writeError(w, http.StatusConflict, "CART_CHANGED", "The cart was checked out concurrently; the payment was voided")
+		case errors.Is(err, errCheckoutFailed):
+			h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to enqueue order")
+		case errors.Is(err, errPaymentUnavailable):
+			// CCA 连不上或超时
+			h.writeError(w, http.StatusServiceUnavailable, "PAYMENT_SERVICE_UNAVAILABLE", err.Error())
+		case errors.Is(err, errPaymentServiceError):
+			// CCA 返回 5xx 或意外状态码
+			h.writeError(w, http.StatusBadGateway, "PAYMENT_SERVICE_ERROR", err.Error())
+		default:
+			// 400 场景（格式错、校验失败） → INVALID_CARD
+			h.writeError(w, http.StatusBadRequest, "INVALID_CARD", err.Error())
+		}
+		return
+	}
+	if order.Status == orders.StatusDeclined {
+		// 402 场景（支付拒绝），Details 里带上 CCA 的拒绝原因码
+		h.writeErrorDetails(w, http.StatusPaymentRequired, "PAYMENT_DECLINED", "Payment was declined", order.DeclineCode)
+		return
+	}
+
+	log.Printf("Order %d created for cart %d with %d items", orderID, cartID, len(cart.Items))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(checkoutResponse{
+		OrderID:  orderID,
+		Discount: quote.Discount,
+		Shipping: quote.Shipping,
+		Total:    quote.Total,
+		Currency: quote.Currency,
+	})
+}
+
+// runCheckout runs the checkout saga for an order saved as pending:
+//
+//  1. authorize the payment                → authorized (or declined)
+//  2. remove the ordered items from the cart → CartCleared
+//  3. publish the order message            → queued
+//
+// Each step is saved before the next one starts. A failure after step 1
+// runs the compensations in reverse: restore the cart, then void the
+// authorization. The cart is cleared before publishing so that nothing
+// can fail once the order is on the queue. Only the ordered lines are
+// removed, so items added to the cart during checkout stay in it; if the
+// ordered items are already gone (another checkout of the same cart got
+// there first) the order is rolled back.
+//
+// A decline is not an error; the returned order is declined. If the order
+// ends up declined or failed the coupon use taken at checkout is released.
+func (h *Handler) runCheckout(ctx context.Context, order orders.Order, payment paymentDetails) (orders.Order, error) {
+	ctx, span := tracing.Start(ctx, "checkout", tracing.KindInternal)
+	span.SetAttribute("order.id", order.OrderID)
+	span.SetAttribute("correlation_id", order.CorrelationID)
+	defer func() {
+		span.SetAttribute("order.status", string(order.Status))
+		span.End()
+
+		failed := order.Status == orders.StatusFailed || order.Status == orders.StatusDeclined
+		if failed && order.CouponCode != "" {
+			h.promotions.Release(order.CouponCode)
+		}
+	}()
+
+	// 金额为 0 的订单（全额折扣且免运费）没有要付的钱，CCA 也不接受 0 金额的授权
+	auth := authorizationResult{Authorized: true}
+	if order.Message.Total > 0 {
+		var err error
+		auth, err = h.authorizePayment(ctx, authorizationRequest{
+			paymentDetails: payment,
+			CustomerID:     order.CustomerID,
+			Amount:         order.Message.Total,
+			Currency:       order.Message.Currency,
+		}, order.CorrelationID, order.IdempotencyKey)
+		if err != nil {
+			span.SetError(err)
+			checkoutsTotal.Inc("error")
+			order.Status = orders.StatusFailed
+			order.FailureReason = err.Error()
+			h.saveOrder(&order)
+			return order, err
+		}
+	}
+	if !auth.Authorized {
+		checkoutsTotal.Inc("declined")
+		order.Status = orders.StatusDeclined
+		order.DeclineCode = auth.DeclineCode
+		h.saveOrder(&order)
+		return order, nil
+	}
+
+	checkoutsTotal.Inc("authorized")
+	order.Status = orders.StatusAuthorized
+	order.AuthorizationID = auth.AuthorizationID
+	order.Message.AuthorizationID = auth.AuthorizationID
+	if err := h.saveOrder(&order); err != nil {
+		order, err = h.rollbackCheckout(ctx, order, fmt.Errorf("saving order: %w", err))
+		return order, err
+	}
+
+	return h.completeCheckout(ctx, order)
+}
+
+// completeCheckout runs the steps after authorization: remove the ordered
+// items from the cart (if not done yet) and publish the order.
+func (h *Handler) completeCheckout(ctx context.Context, order orders.Order) (orders.Order, error) {
+	if !order.CartCleared {
+		if err := h.store.RemoveItems(order.CartID, order.Items, order.CouponCode); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			return h.rollbackCheckout(ctx, order, fmt.Errorf("clearing cart: %w", err))
+		}
+		order.CartCleared = true
+		if err := h.saveOrder(&order); err != nil {
+			return h.rollbackCheckout(ctx, order, fmt.Errorf("saving order: %w", err))
+		}
+	}
+
+	if err := h.publishOrder(ctx, order.Message); err != nil {
+		if errors.Is(err, errPublishUnconfirmed) {
+			// The message may be on the queue, so voiding the payment is
+			// not safe. Left as authorized with the cart cleared, recovery
+			// publishes it again; consumers must tolerate the duplicate.
+			log.Printf("ERROR: order %d left for recovery: %v", order.OrderID, err)
+			return order, nil
+		}
+		return h.rollbackCheckout(ctx, order, fmt.Errorf("publishing order: %w", err))
+	}
+
+	// The warehouse may already have reported on the order, so only move
+	// it to queued if nothing else has moved it on.
+	queued, err := h.orders.Update(order.OrderID, func(o *orders.Order) bool {
+		if !o.Advance(orders.StatusQueued) {
+			return false
+		}
+		o.UpdatedAt = time.Now().UTC()
+		return true
+	})
+	if err != nil {
+		// The order is already on the queue. Left as authorized with the
+		// cart cleared, recovery publishes it again; consumers must
+		// tolerate the duplicate.
+		log.Printf("ERROR: order %d was published but its status was not saved: %v", order.OrderID, err)
+		order.Status = orders.StatusQueued
+		return order, nil
+	}
+	return queued, nil
+}
+
+// rollbackCheckout undoes the steps of an authorized checkout and marks
+// the order failed. Compensation errors are logged: the order is failed
+// either way. A hold that could not be voided expires at the CCA after
+// CCA_HOLD_TTL, which gives the customer's credit back.
+func (h *Handler) rollbackCheckout(ctx context.Context, order orders.Order, cause error) (orders.Order, error) {
+	log.Printf("ERROR: checkout of order %d failed, rolling back: %v", order.OrderID, cause)
+	checkoutRollbacks.Inc()
+	tracing.FromContext(ctx).SetError(cause)
+
+	if order.CartCleared {
+		if err := h.restoreCart(order); err != nil {
+			log.Printf("ERROR: failed to restore cart %d for order %d: %v", order.CartID, order.OrderID, err)
+		} else {
+			order.CartCleared = false
+		}
+	}
+
+	if order.AuthorizationID == "" {
+		// 金额为 0 的订单没有授权；旧版本 CCA 不返回 authorization_id，没法 void
+		if order.Message.Total > 0 {
+			log.Printf("WARN: order %d has no authorization ID; payment hold not voided", order.OrderID)
+		}
+	} else if err := h.voidAuthorization(ctx, order.AuthorizationID, order.CorrelationID); err != nil {
+		log.Printf("ERROR: failed to void authorization %s for order %d: %v", order.AuthorizationID, order.OrderID, err)
+	}
+
+	order.Status = orders.StatusFailed
+	order.FailureReason = cause.Error()
+	h.saveOrder(&order)
+	return order, fmt.Errorf("%w: %w", errCheckoutFailed, cause)
+}
+
+// restoreCart puts the items of an order back into its cart, along with
+// the coupon and shipping method if the cart has none by now.
+func (h *Handler) restoreCart(order orders.Order) error {
+	cart, err := h.store.GetCart(order.CartID)
+	if err != nil {
+		return err
+	}
+	for _, item := range order.Items {
+		if err := h.store.AddItem(order.CartID, item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+	if cart.CouponCode == "" && order.CouponCode != "" {
+		if err := h.store.SetCoupon(order.CartID, order.CouponCode); err != nil {
+			return err
+		}
+	}
+	if cart.ShippingMethod == "" && order.ShippingMethod != "" {
+		if err := h.store.SetShippingMethod(order.CartID, order.ShippingMethod); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveOrder stamps and saves the order. Failures are logged and returned.
+func (h *Handler) saveOrder(order *orders.Order) error {
+	order.UpdatedAt = time.Now().UTC()
+	if err := h.orders.Save(*order); err != nil {
+		log.Printf("ERROR: failed to save order %d (status=%s): %v", order.OrderID, order.Status, err)
+		return err
+	}
+	return nil
+}
+
+// publishOrder publishes an order message to the orders queue as a
+// persistent message, carrying the trace context in the message headers,
+// and waits for the broker to confirm it. A nack is an error; no answer
+// within publishConfirmTimeout is errPublishUnconfirmed.
+func (h *Handler) publishOrder(ctx context.Context, msg messages.OrderMessage) (err error) {
+	ctx, span := tracing.Start(ctx, h.queueName+" publish", tracing.KindProducer)
+	span.SetAttribute("messaging.system", "rabbitmq")
+	span.SetAttribute("messaging.destination.name", h.queueName)
+	span.SetAttribute("order.id", msg.OrderID)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	headers := messages.Headers()
+	tracing.Inject(ctx, headers)
+
+	ctx, cancel := context.WithTimeout(ctx, publishConfirmTimeout)
+	defer cancel()
+	confirm, err := h.mqChannel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		h.queueName,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			Headers:       headers,
+			CorrelationId: msg.CorrelationID,
+			Timestamp:     msg.CreatedAt,
+			Body:          body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	// confirm is nil when the channel is not in confirm mode
+	if confirm != nil {
+		acked, err := confirm.WaitContext(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errPublishUnconfirmed, err)
+		}
+		if !acked {
+			return errors.New("broker nacked the order message")
+		}
+	}
+	ordersPublished.Inc()
+	return nil
+}
+
+// RecoverCheckouts finishes or rolls back checkouts interrupted by a
+// crash. Call it once at startup, before serving requests.
+//
+//   - pending: the authorize call may or may not have reached the CCA. The
+//     hold, if any, is looked up by the order's idempotency key and
+//     voided, and the order is failed.
+//   - authorized, cart not cleared: rolled back (authorization voided).
+//   - authorized, cart cleared: rolled forward (order published again).
+//
+// Coupon uses are not released here; usage counts do not survive a restart.
+func (h *Handler) RecoverCheckouts() {
+	unfinished := h.orders.Unfinished()
+	if len(unfinished) == 0 {
+		return
+	}
+	log.Printf("Recovering %d interrupted checkouts", len(unfinished))
+
+	for _, order := range unfinished {
+		ctx, span := tracing.Start(context.Background(), "recover checkout", tracing.KindInternal)
+		span.SetAttribute("order.id", order.OrderID)
+		switch {
+		case order.Status == orders.StatusPending:
+			log.Printf("WARN: order %d was interrupted during payment authorization; marking failed", order.OrderID)
+			h.voidPendingHold(ctx, order)
+			order.Status = orders.StatusFailed
+			order.FailureReason = "interrupted during payment authorization"
+			h.saveOrder(&order)
+		case order.CartCleared:
+			if _, err := h.completeCheckout(ctx, order); err == nil {
+				log.Printf("Order %d recovered and queued", order.OrderID)
+			}
+		default:
+			h.rollbackCheckout(ctx, order, errors.New("interrupted before the order was published"))
+		}
+		span.End()
+	}
+}
+
+// voidPendingHold voids the hold an interrupted authorize call may have
+// placed for a pending order. Orders saved before idempotency keys were
+// recorded cannot be looked up; their hold is left to expire at the CCA
+// after CCA_HOLD_TTL.
+func (h *Handler) voidPendingHold(ctx context.Context, order orders.Order) {
+	if order.IdempotencyKey == "" {
+		log.Printf("WARN: order %d has no idempotency key; a payment hold, if any, was not voided", order.OrderID)
+		return
+	}
+	authorizationID, err := h.findAuthorization(ctx, order.IdempotencyKey, order.CorrelationID)
+	if err != nil {
+		log.Printf("ERROR: failed to look up the payment hold of order %d: %v", order.OrderID, err)
+		return
+	}
+	if authorizationID == "" {
+		return
+	}
+	if err := h.voidAuthorization(ctx, authorizationID, order.CorrelationID); err != nil {
+		log.Printf("ERROR: failed to void authorization %s for order %d: %v", authorizationID, order.OrderID, err)
+		return
+	}
+	log.Printf("Voided authorization %s of interrupted order %d", authorizationID, order.OrderID)
+}
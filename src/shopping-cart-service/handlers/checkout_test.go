@@ -0,0 +1,289 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+
+	"shopping-cart-service/limits"
+	"shopping-cart-service/orders"
+	"shopping-cart-service/pricing"
+	"shopping-cart-service/products"
+	"shopping-cart-service/promotions"
+	"shopping-cart-service/shipping"
+	"shopping-cart-service/storage"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakePublisher records published order messages.
+type fakePublisher struct {
+	mu   sync.Mutex
+	sent []messages.OrderMessage
+}
+
+func (p *fakePublisher) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	var order messages.OrderMessage
+	if err := json.Unmarshal(msg.Body, &order); err != nil {
+		return nil, err
+	}
+	if msg.DeliveryMode != amqp.Persistent {
+		return nil, errors.New("order message is not persistent")
+	}
+	p.mu.Lock()
+	p.sent = append(p.sent, order)
+	p.mu.Unlock()
+	return nil, nil
+}
+
+// fakeCCA approves every authorization, remembering it by idempotency
+// key, and counts voids.
+type fakeCCA struct {
+	authorized atomic.Int64
+	voided     atomic.Int64
+
+	mu    sync.Mutex
+	byKey map[string]string
+}
+
+func (c *fakeCCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/authorize":
+		id := fmt.Sprintf("auth-%d", c.authorized.Add(1))
+		c.mu.Lock()
+		c.byKey[r.Header.Get(idempotencyKeyHeader)] = id
+		c.mu.Unlock()
+		fmt.Fprintf(w, `{"authorization_id":%q}`, id)
+	case r.URL.Path == "/authorizations":
+		c.mu.Lock()
+		id, ok := c.byKey[r.URL.Query().Get("idempotency_key")]
+		c.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, `{"authorization_id":%q}`, id)
+	case strings.HasSuffix(r.URL.Path, "/void"):
+		c.voided.Add(1)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// testHandler builds a handler backed by fake product, CCA and RabbitMQ
+// services, with every product priced at 100. Product 9 is limited to 3
+// per order.
+func testHandler(t *testing.T, store storage.Store) (*Handler, http.Handler, *fakeCCA, *fakePublisher, orders.Store) {
+	t.Helper()
+	productSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := strings.TrimPrefix(r.URL.Path, "/products/")
+		if id == "9" {
+			fmt.Fprint(w, `{"product_id":9,"price":100,"weight":10,"max_per_order":3}`)
+			return
+		}
+		fmt.Fprintf(w, `{"product_id":%s,"price":100,"weight":10}`, id)
+	}))
+	t.Cleanup(productSrv.Close)
+	cca := &fakeCCA{byKey: make(map[string]string)}
+	ccaSrv := httptest.NewServer(cca)
+	t.Cleanup(ccaSrv.Close)
+
+	productClient := products.NewClient(productSrv.URL)
+	promoEngine := promotions.NewEngine(nil)
+	pricer := pricing.NewPricer(productClient, promoEngine, shipping.NewQuoter(shipping.DefaultRates()), 0)
+	orderStore := orders.NewMemoryStore()
+
+	h := NewHandler(store, ccaSrv.URL+"/authorize", productClient, pricer, promoEngine, limits.Rules{}, false, orderStore, nil, "orders")
+	pub := &fakePublisher{}
+	h.mqChannel = pub
+
+	mux := http.NewServeMux()
+	h.RegisterRoutes(mux)
+	return h, mux, cca, pub, orderStore
+}
+
+func do(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+	return rec
+}
+
+// TestConcurrentAddAndCheckout adds items to a cart while checking it out
+// from other goroutines. Every unit added must end up either in exactly
+// one published order or still in the cart. Run with -race.
+func TestConcurrentAddAndCheckout(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		store storage.Store
+	}{
+		{"memory", storage.NewMemoryStore()},
+		{"sharded", storage.NewShardedStore(4)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, h, cca, pub, orderStore := testHandler(t, tt.store)
+			cartID := tt.store.CreateCart(1)
+
+			const adders, addsEach, checkouts = 4, 25, 20
+			var added atomic.Int64
+			var conflicts atomic.Int64
+			var wg sync.WaitGroup
+
+			for i := 0; i < adders; i++ {
+				wg.Add(1)
+				go func(productID int) {
+					defer wg.Done()
+					for j := 0; j < addsEach; j++ {
+						rec := do(h, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/addItem", cartID),
+							fmt.Sprintf(`{"product_id":%d,"quantity":1}`, productID))
+						if rec.Code != http.StatusNoContent {
+							t.Errorf("addItem: %d %s", rec.Code, rec.Body)
+							return
+						}
+						added.Add(1)
+					}
+				}(i%2 + 1)
+			}
+			for i := 0; i < checkouts; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					rec := do(h, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/checkout", cartID),
+						`{"credit_card_number":"4242424242424242"}`)
+					switch rec.Code {
+					case http.StatusOK:
+					case http.StatusConflict:
+						conflicts.Add(1)
+					case http.StatusBadRequest:
+						if !strings.Contains(rec.Body.String(), "EMPTY_CART") {
+							t.Errorf("checkout: %d %s", rec.Code, rec.Body)
+						}
+					default:
+						t.Errorf("checkout: %d %s", rec.Code, rec.Body)
+					}
+				}()
+			}
+			wg.Wait()
+
+			// Whatever is left in the cart is checked out last
+			if rec := do(h, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/checkout", cartID),
+				`{"credit_card_number":"4242424242424242"}`); rec.Code != http.StatusOK && rec.Code != http.StatusBadRequest {
+				t.Fatalf("final checkout: %d %s", rec.Code, rec.Body)
+			}
+
+			var ordered int64
+			for _, msg := range pub.sent {
+				for _, item := range msg.Items {
+					ordered += int64(item.Quantity)
+				}
+				order, err := orderStore.Get(msg.OrderID)
+				if err != nil || order.Status != orders.StatusQueued {
+					t.Errorf("published order %d: %+v, %v", msg.OrderID, order, err)
+				}
+			}
+			cart, err := tt.store.GetCart(cartID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var left int64
+			for _, item := range cart.Items {
+				left += int64(item.Quantity)
+			}
+
+			if ordered+left != added.Load() {
+				t.Errorf("added %d units, ordered %d and %d left in the cart", added.Load(), ordered, left)
+			}
+			if left != 0 {
+				t.Errorf("%d units left after the final checkout", left)
+			}
+			if got := cca.voided.Load(); got != conflicts.Load() {
+				t.Errorf("%d authorizations voided for %d conflicting checkouts", got, conflicts.Load())
+			}
+			if got, want := cca.authorized.Load(), int64(len(pub.sent))+conflicts.Load(); got != want {
+				t.Errorf("%d authorizations for %d orders and %d conflicts", got, len(pub.sent), conflicts.Load())
+			}
+		})
+	}
+}
+
+// TestRecoverPendingCheckout voids the hold placed by a checkout that was
+// interrupted before it recorded the authorization.
+func TestRecoverPendingCheckout(t *testing.T) {
+	h, _, cca, _, orderStore := testHandler(t, storage.NewMemoryStore())
+	cca.byKey["key-held"] = "auth-held"
+
+	for _, order := range []orders.Order{
+		{OrderID: 1, Status: orders.StatusPending, IdempotencyKey: "key-held"},
+		{OrderID: 2, Status: orders.StatusPending, IdempotencyKey: "key-unknown"},
+		{OrderID: 3, Status: orders.StatusPending},
+	} {
+		if err := orderStore.Save(order); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.RecoverCheckouts()
+
+	if got := cca.voided.Load(); got != 1 {
+		t.Errorf("%d holds voided, want 1", got)
+	}
+	for id := 1; id <= 3; id++ {
+		if order, _ := orderStore.Get(id); order.Status != orders.StatusFailed {
+			t.Errorf("order %d is %s, want failed", id, order.Status)
+		}
+	}
+}
+
+// TestCouponMaxUsesAtCheckout counts a coupon use when an order is placed,
+// not when the coupon is applied to a cart.
+func TestCouponMaxUsesAtCheckout(t *testing.T) {
+	store := storage.NewMemoryStore()
+	h, mux, _, pub, _ := testHandler(t, store)
+	engine := promotions.NewEngine([]promotions.Promotion{
+		{Code: "ONCE", Type: promotions.TypePercent, Percent: 10, MaxUses: 1},
+	})
+	h.promotions = engine
+	h.pricer = pricing.NewPricer(h.products, engine, shipping.NewQuoter(shipping.DefaultRates()), 0)
+
+	var carts []int
+	for customerID := 1; customerID <= 2; customerID++ {
+		cartID := store.CreateCart(customerID)
+		if rec := do(mux, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/addItem", cartID),
+			`{"product_id":1,"quantity":2}`); rec.Code != http.StatusNoContent {
+			t.Fatalf("addItem: %d %s", rec.Code, rec.Body)
+		}
+		if rec := do(mux, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/applyCoupon", cartID),
+			`{"code":"ONCE"}`); rec.Code != http.StatusOK {
+			t.Fatalf("applyCoupon to cart %d: %d %s", cartID, rec.Code, rec.Body)
+		}
+		carts = append(carts, cartID)
+	}
+
+	if rec := do(mux, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/checkout", carts[0]),
+		`{"credit_card_number":"4242424242424242"}`); rec.Code != http.StatusOK {
+		t.Fatalf("first checkout: %d %s", rec.Code, rec.Body)
+	}
+	rec := do(mux, http.MethodPost, fmt.Sprintf("/shopping-carts/%d/checkout", carts[1]),
+		`{"credit_card_number":"4242424242424242"}`)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "COUPON_USAGE_LIMIT_REACHED") {
+		t.Fatalf("second checkout: %d %s, want 409 COUPON_USAGE_LIMIT_REACHED", rec.Code, rec.Body)
+	}
+	if len(pub.sent) != 1 {
+		t.Errorf("%d orders published, want 1", len(pub.sent))
+	}
+}
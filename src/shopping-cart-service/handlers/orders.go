@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"common/messages"
+
+	"shopping-cart-service/orders"
+)
+
+// orderResponse is the body of GET /orders/{id}.
+type orderResponse struct {
+	OrderID         int                  `json:"order_id"`
+	CartID          int                  `json:"cart_id"`
+	CustomerID      int                  `json:"customer_id"`
+	Status          orders.Status        `json:"status"`
+	AuthorizationID string               `json:"authorization_id,omitempty"`
+	DeclineCode     string               `json:"decline_code,omitempty"`
+	FailureReason   string               `json:"failure_reason,omitempty"`
+	Items           []messages.OrderItem `json:"items"`
+	Backordered     []messages.OrderItem `json:"backordered,omitempty"`
+	Shipping        int64                `json:"shipping"`
+	Total           int64                `json:"total"`
+	Currency        string               `json:"currency"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+}
+
+// orderStatusURL is the status URL returned by async checkout.
+func orderStatusURL(orderID int) string {
+	return "/orders/" + strconv.Itoa(orderID)
+}
+
+// handleGetOrder handles GET /orders/{id}.
+func (h *Handler) handleGetOrder(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.writeError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	orderID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/orders/"))
+	if err != nil || orderID < 1 {
+		h.writeError(w, http.StatusBadRequest, "INVALID_INPUT", "Invalid order ID")
+		return
+	}
+
+	order, err := h.orders.Get(orderID)
+	if err != nil {
+		if errors.Is(err, orders.ErrNotFound) {
+			h.writeError(w, http.StatusNotFound, "ORDER_NOT_FOUND", "Order not found")
+			return
+		}
+		log.Printf("ERROR: failed to get order: %v", err)
+		h.writeError(w, http.StatusInternalServerError, "INTERNAL_ERROR", "Failed to retrieve order")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(orderResponse{
+		OrderID:         order.OrderID,
+		CartID:          order.CartID,
+		CustomerID:      order.CustomerID,
+		Status:          order.Status,
+		AuthorizationID: order.AuthorizationID,
+		DeclineCode:     order.DeclineCode,
+		FailureReason:   order.FailureReason,
+		Items:           order.Message.Items,
+		Backordered:     order.Backordered,
+		Shipping:        order.Message.Shipping,
+		Total:           order.Message.Total,
+		Currency:        order.Message.Currency,
+		CreatedAt:       order.CreatedAt,
+		UpdatedAt:       order.UpdatedAt,
+	})
+}
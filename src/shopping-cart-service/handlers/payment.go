@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+var (
+	// errPaymentUnavailable means the CCA could not be reached or timed out.
+	errPaymentUnavailable = errors.New("payment service unavailable")
+
+	// errPaymentServiceError means the CCA answered with a 5xx or unexpected status.
+	errPaymentServiceError = errors.New("payment service error")
+)
+
+// paymentDetails is the payment part of the checkout request, forwarded
+// as-is to the CCA. Exactly one of CreditCardNumber and CardToken (issued
+// by the CCA tokenize endpoint) must be set. Expiry (MM/YY) and CVV are
+// optional.
+type paymentDetails struct {
+	CreditCardNumber string `json:"credit_card_number,omitempty"`
+	CardToken        string `json:"card_token,omitempty"`
+	Expiry           string `json:"expiry,omitempty"`
+	CVV              string `json:"cvv,omitempty"`
+}
+
+// validate checks that exactly one card reference is present.
+func (p paymentDetails) validate() error {
+	if p.CreditCardNumber == "" && p.CardToken == "" {
+		return errors.New("credit_card_number or card_token is required")
+	}
+	if p.CreditCardNumber != "" && p.CardToken != "" {
+		return errors.New("provide either credit_card_number or card_token, not both")
+	}
+	return nil
+}
+
+// authorizationRequest is the body sent to the CCA authorize endpoint.
+type authorizationRequest struct {
+	paymentDetails
+	CustomerID int    `json:"customer_id,omitempty"`
+	Amount     int64  `json:"amount"`
+	Currency   string `json:"currency,omitempty"`
+}
+
+// idempotencyKeyHeader carries the order's idempotency key on authorize
+// calls; the CCA returns the existing hold for a key it has seen.
+const idempotencyKeyHeader = "Idempotency-Key"
+
+// authorizationResult is the outcome of a CCA authorize call.
+type authorizationResult struct {
+	Authorized      bool
+	AuthorizationID string // set when authorized; empty with an older CCA
+	DeclineCode     string // set when declined, e.g. PAYMENT_DECLINED or a risk rule code
+}
+
+// authorizePayment calls the credit card authorizer service. A decline is
+// not an error: it is reported through authorizationResult.Authorized.
+//
+// 协议和 OpenAPI 对齐：
+//   - 200 OK  → 授权成功
+//   - 400 Bad Request → 卡号格式错误
+//   - 402 Payment Required → 授权被拒（风控命中时 error 字段是原因码）
+func (h *Handler) authorizePayment(ctx context.Context, payment authorizationRequest, correlationID, idempotencyKey string) (authorizationResult, error) {
+	reqBody, _ := json.Marshal(payment)
+
+	// ★ 关键改动：不再自己拼路径，直接用环境变量里的完整 URL
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.ccaURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return authorizationResult{}, fmt.Errorf("failed to build payment request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(CorrelationIDHeader, correlationID)
+	if idempotencyKey != "" {
+		req.Header.Set(idempotencyKeyHeader, idempotencyKey)
+	}
+
+	resp, err := h.ccaClient.Do(req)
+	if err != nil {
+		return authorizationResult{}, fmt.Errorf("%w: failed to contact payment service", errPaymentUnavailable)
+	}
+	defer resp.Body.Close()
+
+	// ★ 为了 debug 更清楚，把 CCA 的错误码和信息带进错误信息里
+	if resp.StatusCode == http.StatusBadRequest {
+		var cca ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&cca); err != nil || cca.Error == "" {
+			return authorizationResult{}, fmt.Errorf("invalid credit card format")
+		}
+		return authorizationResult{}, fmt.Errorf("%s: %s", cca.Error, cca.Message)
+	}
+
+	if resp.StatusCode == http.StatusPaymentRequired {
+		// 402 → 拒绝
+		var cca ErrorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&cca)
+		return authorizationResult{DeclineCode: cca.Error}, nil
+	}
+
+	if resp.StatusCode == http.StatusOK {
+		// 200 → 授权通过；旧版本 CCA 不返回 authorization_id，这里允许为空
+		var result struct {
+			AuthorizationID string `json:"authorization_id"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&result)
+		return authorizationResult{AuthorizationID: result.AuthorizationID, Authorized: true}, nil
+	}
+
+	// 其他情况，一律认为是“payment service 返回了意外状态码”
+	return authorizationResult{}, fmt.Errorf("%w: unexpected response from payment service (status %d)", errPaymentServiceError, resp.StatusCode)
+}
+
+// findAuthorization looks up the hold an authorize call with
+// idempotencyKey placed, for when the caller never saw the answer. It
+// returns an empty ID if the CCA has none.
+//
+//   - 200 OK → 找到授权
+//   - 404 Not Found → 授权请求没到 CCA，或者被拒了，没有 hold
+func (h *Handler) findAuthorization(ctx context.Context, idempotencyKey, correlationID string) (string, error) {
+	base := strings.TrimSuffix(h.ccaURL, "/authorize")
+	url := base + "/authorizations?idempotency_key=" + neturl.QueryEscape(idempotencyKey)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to build authorization lookup: %w", err)
+	}
+	req.Header.Set(CorrelationIDHeader, correlationID)
+
+	resp, err := h.ccaClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: failed to contact payment service", errPaymentUnavailable)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var result struct {
+			AuthorizationID string `json:"authorization_id"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return "", fmt.Errorf("%w: invalid authorization lookup response: %v", errPaymentServiceError, err)
+		}
+		return result.AuthorizationID, nil
+	case http.StatusNotFound:
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w: authorization lookup failed (status %d)", errPaymentServiceError, resp.StatusCode)
+	}
+}
+
+// voidAuthorization releases a hold placed by authorizePayment. The CCA
+// lifecycle endpoints live next to the authorize endpoint.
+//
+//   - 200 OK → voided
+//   - 409 Conflict → 已经不是 authorized（比如上一次恢复时已经 void 过，或 hold 已经过期），当作完成
+func (h *Handler) voidAuthorization(ctx context.Context, authorizationID, correlationID string) error {
+	base := strings.TrimSuffix(h.ccaURL, "/authorize")
+	url := base + "/authorizations/" + authorizationID + "/void"
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build void request: %w", err)
+	}
+	req.Header.Set(CorrelationIDHeader, correlationID)
+
+	resp, err := h.ccaClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: failed to contact payment service", errPaymentUnavailable)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusConflict:
+		return nil
+	default:
+		return fmt.Errorf("%w: void of %s failed (status %d)", errPaymentServiceError, authorizationID, resp.StatusCode)
+	}
+}
@@ -0,0 +1,47 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+
+	"shopping-cart-service/products"
+)
+
+var (
+	// ErrLineQuantity is returned when one line exceeds MaxLineQuantity.
+	ErrLineQuantity = errors.New("quantity limit exceeded")
+
+	// ErrTooManyLines is returned when a cart would hold more than MaxLines products.
+	ErrTooManyLines = errors.New("too many products in cart")
+
+	// ErrProductLimit is returned when a line exceeds the product's max_per_order.
+	ErrProductLimit = errors.New("product purchase limit exceeded")
+)
+
+// Rules bounds what a cart may hold. Zero fields disable that check.
+// Per-product limits come from the product's MaxPerOrder.
+type Rules struct {
+	MaxLineQuantity int
+	MaxLines        int
+}
+
+// CheckLine checks the total quantity of one product in a cart.
+func (r Rules) CheckLine(product products.Product, quantity int) error {
+	if r.MaxLineQuantity > 0 && quantity > r.MaxLineQuantity {
+		return fmt.Errorf("%w: product %d quantity %d exceeds %d per line",
+			ErrLineQuantity, product.ProductID, quantity, r.MaxLineQuantity)
+	}
+	if product.MaxPerOrder > 0 && quantity > product.MaxPerOrder {
+		return fmt.Errorf("%w: product %d is limited to %d per order",
+			ErrProductLimit, product.ProductID, product.MaxPerOrder)
+	}
+	return nil
+}
+
+// CheckLines checks the number of distinct products in a cart.
+func (r Rules) CheckLines(lines int) error {
+	if r.MaxLines > 0 && lines > r.MaxLines {
+		return fmt.Errorf("%w: %d products exceeds %d per cart", ErrTooManyLines, lines, r.MaxLines)
+	}
+	return nil
+}
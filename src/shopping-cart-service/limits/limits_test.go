@@ -0,0 +1,52 @@
+package limits
+
+import (
+	"errors"
+	"testing"
+
+	"shopping-cart-service/products"
+)
+
+func TestCheckLine(t *testing.T) {
+	rules := Rules{MaxLineQuantity: 10}
+	tests := []struct {
+		rules    Rules
+		product  products.Product
+		quantity int
+		err      error
+	}{
+		{rules, products.Product{ProductID: 1}, 10, nil},
+		{rules, products.Product{ProductID: 1}, 11, ErrLineQuantity},
+		{rules, products.Product{ProductID: 1, MaxPerOrder: 3}, 3, nil},
+		{rules, products.Product{ProductID: 1, MaxPerOrder: 3}, 4, ErrProductLimit},
+		// Over both limits, the cart-wide one is reported
+		{rules, products.Product{ProductID: 1, MaxPerOrder: 3}, 11, ErrLineQuantity},
+		{Rules{}, products.Product{ProductID: 1}, 1 << 40, nil},
+		{Rules{}, products.Product{ProductID: 1, MaxPerOrder: 3}, 4, ErrProductLimit},
+	}
+	for _, tt := range tests {
+		err := tt.rules.CheckLine(tt.product, tt.quantity)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("%+v.CheckLine(max_per_order %d, %d) = %v, want %v",
+				tt.rules, tt.product.MaxPerOrder, tt.quantity, err, tt.err)
+		}
+	}
+}
+
+func TestCheckLines(t *testing.T) {
+	tests := []struct {
+		rules Rules
+		lines int
+		err   error
+	}{
+		{Rules{MaxLines: 2}, 2, nil},
+		{Rules{MaxLines: 2}, 3, ErrTooManyLines},
+		{Rules{}, 1000, nil},
+	}
+	for _, tt := range tests {
+		err := tt.rules.CheckLines(tt.lines)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("%+v.CheckLines(%d) = %v, want %v", tt.rules, tt.lines, err, tt.err)
+		}
+	}
+}
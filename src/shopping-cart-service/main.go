@@ -1,23 +1,59 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
 
+	"common/metrics"
+	"common/redact"
+	"common/routes"
+	"common/tracing"
+
+	"shopping-cart-service/expiry"
+	"shopping-cart-service/fulfillment"
 	"shopping-cart-service/handlers"
+	"shopping-cart-service/limits"
+	"shopping-cart-service/orders"
+	"shopping-cart-service/pricing"
+	"shopping-cart-service/products"
+	"shopping-cart-service/promotions"
+	"shopping-cart-service/shipping"
 	"shopping-cart-service/storage"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 func main() {
+	// Mask card numbers in every log line
+	log.SetOutput(redact.NewWriter(os.Stderr))
+
+	// Export spans (OTEL_EXPORTER_OTLP_ENDPOINT or TRACE_FILE)
+	stopTracing, err := tracing.Init("shopping-cart-service")
+	if err != nil {
+		log.Fatalf("failed to start tracing: %v", err)
+	}
+
 	// 1. Read CCA endpoint
 	ccaURL := os.Getenv("CCA_URL")
 	if ccaURL == "" {
 		ccaURL = "http://localhost:8082"
 	}
 
+	// Product service is used for pricing and item snapshots on published orders
+	productURL := os.Getenv("PRODUCT_SERVICE_URL")
+	if productURL == "" {
+		productURL = "http://product-service:8080"
+	}
+
 	// 2. Connect to RabbitMQ
 	rabbitURI := os.Getenv("RABBITMQ_URI")
 	if rabbitURI == "" {
@@ -37,6 +73,11 @@ func main() {
 	}
 	defer ch.Close()
 
+	// Publisher confirms: checkout waits for the broker to take each order
+	if err := ch.Confirm(false); err != nil {
+		log.Fatalf("failed to enable publisher confirms: %v", err)
+	}
+
 	// Declare the order queue (consumed by Warehouse)
 	q, err := ch.QueueDeclare(
 		"orders",
@@ -50,15 +91,178 @@ func main() {
 		log.Fatalf("failed to declare orders queue: %v", err)
 	}
 
-	// 3. Initialize in-memory storage
-	store := storage.NewMemoryStore()
+	// 3. Initialize storage: in memory by default, sharded in memory with CART_STORE=sharded,
+	// or durable on disk with CART_STORE=file. Orders (the checkout saga state)
+	// are kept on disk next to the carts with the file store, in memory otherwise.
+	var store storage.Store
+	var orderStore orders.Store = orders.NewMemoryStore()
+	switch os.Getenv("CART_STORE") {
+	case "", "memory":
+		store = storage.NewMemoryStore()
+	case "sharded":
+		shards := 32
+		if val := os.Getenv("CART_STORE_SHARDS"); val != "" {
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				shards = n
+			} else {
+				log.Printf("Ignoring invalid CART_STORE_SHARDS %q", val)
+			}
+		}
+		store = storage.NewShardedStore(shards)
+		log.Printf("Using sharded cart store with %d shards", shards)
+	case "file":
+		dataDir := os.Getenv("CART_DATA_DIR")
+		if dataDir == "" {
+			dataDir = "/var/lib/shopping-cart"
+		}
+		snapshotEvery := 1000
+		if val := os.Getenv("CART_SNAPSHOT_EVERY"); val != "" {
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				snapshotEvery = n
+			} else {
+				log.Printf("Ignoring invalid CART_SNAPSHOT_EVERY %q", val)
+			}
+		}
+		syncWrites := true
+		if val := os.Getenv("CART_WAL_SYNC"); val != "" {
+			syncWrites, _ = strconv.ParseBool(val)
+		}
+
+		fileStore, err := storage.NewFileStore(dataDir, snapshotEvery, syncWrites)
+		if err != nil {
+			log.Fatalf("failed to open cart store in %s: %v", dataDir, err)
+		}
+		defer func() {
+			if err := fileStore.Close(); err != nil {
+				log.Printf("failed to close cart store: %v", err)
+			}
+		}()
+		store = fileStore
+		log.Printf("Using file cart store in %s", dataDir)
+
+		fileOrders, err := orders.NewFileStore(filepath.Join(dataDir, "orders.jsonl"))
+		if err != nil {
+			log.Fatalf("failed to open order store in %s: %v", dataDir, err)
+		}
+		defer func() {
+			if err := fileOrders.Close(); err != nil {
+				log.Printf("failed to close order store: %v", err)
+			}
+		}()
+		orderStore = fileOrders
+	default:
+		log.Fatalf("unknown CART_STORE %q (want memory, sharded or file)", os.Getenv("CART_STORE"))
+	}
+
+	// Tax rate in basis points applied to cart subtotals (800 = 8%)
+	var taxBPS int64
+	if val := os.Getenv("CART_TAX_RATE_BPS"); val != "" {
+		if n, err := strconv.ParseInt(val, 10, 64); err == nil && n >= 0 {
+			taxBPS = n
+		} else {
+			log.Printf("Ignoring invalid CART_TAX_RATE_BPS %q", val)
+		}
+	}
+
+	// Promotions are loaded once from the JSON file at CART_PROMOTIONS
+	var promos []promotions.Promotion
+	if path := os.Getenv("CART_PROMOTIONS"); path != "" {
+		promos, err = promotions.LoadConfig(path)
+		if err != nil {
+			log.Fatalf("Failed to load promotions: %v", err)
+		}
+		log.Printf("Loaded %d promotions from %s", len(promos), path)
+	}
+	promoEngine := promotions.NewEngine(promos)
+
+	// Shipping rate tables by method and weight band, from CART_SHIPPING_RATES or built-in defaults
+	rates := shipping.DefaultRates()
+	if path := os.Getenv("CART_SHIPPING_RATES"); path != "" {
+		rates, err = shipping.LoadRates(path)
+		if err != nil {
+			log.Fatalf("Failed to load shipping rates: %v", err)
+		}
+		log.Printf("Loaded %d shipping methods from %s", len(rates.Methods), path)
+	}
+
+	productClient := products.NewClient(productURL)
+	pricer := pricing.NewPricer(productClient, promoEngine, shipping.NewQuoter(rates), taxBPS)
+
+	// 4. Create handler — passing storage, CCA URL, product client, pricer, promotions, orders, and RabbitMQ components
+	// CART_ONE_PER_CUSTOMER=true makes POST /shopping-cart return the customer's open cart
+	oneCartPerCustomer, _ := strconv.ParseBool(os.Getenv("CART_ONE_PER_CUSTOMER"))
+
+	// Cart limits: CART_MAX_LINE_QUANTITY per product line, CART_MAX_LINES distinct products (0 disables)
+	cartLimits := limits.Rules{
+		MaxLineQuantity: envInt("CART_MAX_LINE_QUANTITY", 99),
+		MaxLines:        envInt("CART_MAX_LINES", 50),
+	}
+
+	handler := handlers.NewHandler(store, ccaURL, productClient, pricer, promoEngine, cartLimits, oneCartPerCustomer, orderStore, ch, q.Name)
+
+	// Finish or roll back checkouts a previous run left in flight
+	handler.RecoverCheckouts()
 
-	// 4. Create handler — passing storage, CCA URL, and RabbitMQ components
-	handler := handlers.NewHandler(store, ccaURL, ch, q.Name)
+	// Forget orders finished (declined, failed, fulfilled, backordered) for CART_ORDER_TTL
+	orderSweepCtx, stopOrderSweeper := context.WithCancel(context.Background())
+	defer stopOrderSweeper()
+	if ttl := envDuration("CART_ORDER_TTL", 24*time.Hour); ttl > 0 {
+		go orders.Sweep(orderSweepCtx, orderStore, ttl, time.Minute)
+	}
+
+	// CART_CHECKOUT_MODE=async answers checkout with 202 and runs authorization
+	// and publishing on CART_CHECKOUT_WORKERS workers fed by a queue of CART_CHECKOUT_QUEUE orders
+	switch mode := os.Getenv("CART_CHECKOUT_MODE"); mode {
+	case "", "sync":
+	case "async":
+		workers := envInt("CART_CHECKOUT_WORKERS", 16)
+		queueSize := envInt("CART_CHECKOUT_QUEUE", 1000)
+		handler.EnableAsyncCheckout(workers, queueSize)
+		log.Printf("Async checkout with %d workers, queue of %d", workers, queueSize)
+	default:
+		log.Fatalf("unknown CART_CHECKOUT_MODE %q (want sync or async)", mode)
+	}
 
-	// 5. Register HTTP routes
+	// 5. Register HTTP routes; expvar counters (carts_swept, ...) are served at /debug/vars
+	// and Prometheus metrics, including per-route request counts and latencies, at /metrics
 	mux := http.NewServeMux()
 	handler.RegisterRoutes(mux)
+	mux.Handle("/debug/vars", expvar.Handler())
+	mux.Handle("/metrics", metrics.Handler())
+
+	// Expire carts idle for CART_TTL and report the ones left with items as abandoned
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	if ttl := envDuration("CART_TTL", 30*time.Minute); ttl > 0 {
+		if err := expiry.DeclareQueue(ch); err != nil {
+			log.Fatalf("failed to declare abandoned carts queue: %v", err)
+		}
+		interval := envDuration("CART_SWEEP_INTERVAL", time.Minute)
+		if interval == 0 {
+			interval = time.Minute
+		}
+		sweeper := expiry.NewSweeper(store, ttl, interval, ch)
+		go sweeper.Run(sweepCtx)
+		log.Printf("Expiring carts idle for %s", ttl)
+	}
+
+	// Apply warehouse status events (received, fulfilled, backordered) to orders,
+	// on a channel of its own so consuming does not interfere with publishing
+	statusCh, err := conn.Channel()
+	if err != nil {
+		log.Fatalf("failed to open order status channel: %v", err)
+	}
+	defer statusCh.Close()
+	if err := fulfillment.Declare(statusCh); err != nil {
+		log.Fatalf("failed to declare order status queue: %v", err)
+	}
+	listenCtx, stopListener := context.WithCancel(context.Background())
+	defer stopListener()
+	go func() {
+		if err := fulfillment.NewListener(orderStore, statusCh).Run(listenCtx); err != nil {
+			log.Printf("order status listener stopped: %v", err)
+		}
+	}()
 
 	// 6. Start HTTP server
 	addr := ":8081"
@@ -66,6 +270,69 @@ func main() {
 		addr = ":" + port
 	}
 
-	log.Println("Starting shopping cart service on", addr)
-	log.Fatal(http.ListenAndServe(addr, mux))
+	names := routes.New(mux, handlers.Routes...)
+	srv := &http.Server{Addr: addr, Handler: tracing.Middleware(metrics.Instrument(mux, names), names)}
+
+	go func() {
+		log.Println("Starting shopping cart service on", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// Wait for SIGINT/SIGTERM, then stop accepting connections and let
+	// in-flight requests finish before exiting.
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutting down shopping cart service...")
+	stopSweeper()
+	stopOrderSweeper()
+	stopListener()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("graceful shutdown failed: %v", err)
+	}
+
+	// Queued async checkouts get CART_CHECKOUT_DRAIN_TIMEOUT of their own to finish
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), envDuration("CART_CHECKOUT_DRAIN_TIMEOUT", 10*time.Second))
+	defer cancelDrain()
+	handler.StopAsyncCheckout(drainCtx)
+
+	if err := stopTracing(ctx); err != nil {
+		log.Printf("flushing traces failed: %v", err)
+	}
+	log.Println("Shopping cart service stopped")
+}
+
+// envInt reads a non-negative integer, falling back to def when unset or
+// invalid.
+func envInt(key string, def int) int {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	n, err := strconv.Atoi(val)
+	if err != nil || n < 0 {
+		log.Printf("Ignoring invalid %s %q", key, val)
+		return def
+	}
+	return n
+}
+
+// envDuration reads a time.ParseDuration value, falling back to def when
+// unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	val := os.Getenv(key)
+	if val == "" {
+		return def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d < 0 {
+		log.Printf("Ignoring invalid %s %q", key, val)
+		return def
+	}
+	return d
 }
@@ -1,10 +1,23 @@
 package models
 
+import "time"
+
 // ShoppingCart represents a shopping cart.
 type ShoppingCart struct {
-	ShoppingCartID int         `json:"shopping_cart_id"`
-	CustomerID     int         `json:"customer_id"`
-	Items          []CartItem  `json:"items"`
+	ShoppingCartID int        `json:"shopping_cart_id"`
+	CustomerID     int        `json:"customer_id"`
+	Items          []CartItem `json:"items"`
+	CouponCode     string     `json:"coupon_code,omitempty"`
+	ShippingMethod string     `json:"shipping_method,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Clone returns a deep copy of the cart, sharing no memory with it.
+func (c *ShoppingCart) Clone() *ShoppingCart {
+	cp := *c
+	cp.Items = append(make([]CartItem, 0, len(c.Items)), c.Items...)
+	return &cp
 }
 
 // CartItem represents an item in the cart.
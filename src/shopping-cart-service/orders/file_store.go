@@ -0,0 +1,209 @@
+package orders
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"shopping-cart-service/models"
+)
+
+// FileStore is a durable Store. Orders are held in memory and every Save
+// appends the order's full state to a JSON-lines log and fsyncs it. On
+// open the log is replayed (the last record of each order wins) and
+// rewritten with one record per order.
+type FileStore struct {
+	*MemoryStore
+
+	path string
+	log  *os.File
+}
+
+// NewFileStore opens (or creates) the order log at path.
+func NewFileStore(path string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.rewrite(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load replays the order log into memory.
+func (s *FileStore) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var order Order
+		if err := json.Unmarshal(scanner.Bytes(), &order); err != nil {
+			// A torn final line from a crash mid-append
+			log.Printf("WARN: ignoring unreadable order log record: %v", err)
+			break
+		}
+		s.put(order)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading order log: %w", err)
+	}
+
+	log.Printf("Restored %d orders from %s", len(s.orders), s.path)
+	return nil
+}
+
+// rewrite compacts the log to one record per order, in order ID order,
+// and reopens it for appending. The caller must hold s.mu once the store
+// is open.
+func (s *FileStore) rewrite() error {
+	ids := make([]int, 0, len(s.orders))
+	for id := range s.orders {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, id := range ids {
+		if err := enc.Encode(s.orders[id]); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	// The previous log, if any, points at the replaced file
+	if s.log != nil {
+		s.log.Close()
+	}
+	s.log, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	return err
+}
+
+// Save appends the order to the log, then updates memory. The order is
+// only visible once it is durable.
+func (s *FileStore) Save(order Order) error {
+	line, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.appendLocked(line); err != nil {
+		return err
+	}
+	s.put(order)
+	return nil
+}
+
+// Update applies fn to an order and, if it reports a change, logs and
+// stores the result.
+func (s *FileStore) Update(orderID int, fn func(order *Order) bool) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.orders[orderID]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	order := current
+	order.Items = append([]models.CartItem(nil), current.Items...)
+	if !fn(&order) {
+		return current, nil
+	}
+
+	line, err := json.Marshal(order)
+	if err != nil {
+		return current, err
+	}
+	if err := s.appendLocked(line); err != nil {
+		return current, err
+	}
+	s.put(order)
+	return order, nil
+}
+
+// EvictFinished deletes finished orders last updated before cutoff and
+// compacts the log so they do not come back on restart.
+func (s *FileStore) EvictFinished(cutoff time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return 0
+	}
+	n := s.evictLocked(cutoff)
+	if n > 0 {
+		if err := s.rewrite(); err != nil {
+			log.Printf("ERROR: failed to compact order log after eviction: %v", err)
+		}
+	}
+	return n
+}
+
+// appendLocked appends one record to the log and fsyncs it. The caller
+// must hold s.mu.
+func (s *FileStore) appendLocked(line []byte) error {
+	if s.log == nil {
+		return errors.New("order store is closed")
+	}
+	if _, err := s.log.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("appending to order log: %w", err)
+	}
+	if err := s.log.Sync(); err != nil {
+		return fmt.Errorf("syncing order log: %w", err)
+	}
+	return nil
+}
+
+// Close closes the order log.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
@@ -0,0 +1,275 @@
+package orders
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"common/messages"
+
+	"shopping-cart-service/models"
+)
+
+// ErrNotFound is returned when an order does not exist.
+var ErrNotFound = errors.New("order not found")
+
+// Status is the state of an order as reported to clients.
+type Status string
+
+const (
+	// StatusPending: checkout started, payment not yet authorized.
+	StatusPending Status = "pending"
+
+	// StatusAuthorized: payment authorized, order not yet published.
+	StatusAuthorized Status = "authorized"
+
+	// StatusDeclined: the authorizer declined the payment.
+	StatusDeclined Status = "declined"
+
+	// StatusQueued: the order message is on the orders queue.
+	StatusQueued Status = "queued"
+
+	// StatusFailed: checkout failed and was rolled back.
+	StatusFailed Status = "failed"
+
+	// Fulfillment states reported by the warehouse after queued.
+
+	// StatusReceived: the warehouse took the order off the queue.
+	StatusReceived Status = "received"
+
+	// StatusBackordered: some lines are out of stock.
+	StatusBackordered Status = "backordered"
+
+	// StatusFulfilled: the order left the warehouse.
+	StatusFulfilled Status = "fulfilled"
+)
+
+// fulfillmentRank orders the states an order moves through once it is
+// published. Status events can arrive out of order or twice; an order
+// only moves to a higher rank.
+var fulfillmentRank = map[Status]int{
+	StatusQueued:      1,
+	StatusReceived:    2,
+	StatusBackordered: 3,
+	StatusFulfilled:   4,
+}
+
+// Advance moves a published order to a fulfillment status. It reports
+// false, leaving the order unchanged, if the order was never published or
+// is already at or past status.
+func (o *Order) Advance(status Status) bool {
+	// authorized with the cart cleared: published, but queued not yet saved
+	published := o.Status == StatusAuthorized && o.CartCleared
+	current, ok := fulfillmentRank[o.Status]
+	if !ok && !published {
+		return false
+	}
+	if fulfillmentRank[status] <= current {
+		return false
+	}
+	o.Status = status
+	return true
+}
+
+// Order is the record of one checkout. It doubles as the persisted state
+// of the checkout saga: Status and CartCleared say which steps have run,
+// and Message is what gets published, so an interrupted checkout can be
+// resumed or rolled back at startup.
+type Order struct {
+	OrderID       int    `json:"order_id"`
+	CartID        int    `json:"cart_id"`
+	CustomerID    int    `json:"customer_id"`
+	Status        Status `json:"status"`
+	CorrelationID string `json:"correlation_id"`
+
+	// IdempotencyKey is sent with the authorize call and saved before it,
+	// so a hold placed by an interrupted checkout can be found and voided.
+	IdempotencyKey  string `json:"idempotency_key,omitempty"`
+	AuthorizationID string `json:"authorization_id,omitempty"`
+	DeclineCode     string `json:"decline_code,omitempty"`
+	FailureReason   string `json:"failure_reason,omitempty"`
+
+	// Cart contents taken at checkout, used to restore the cart on rollback.
+	Items          []models.CartItem `json:"items"`
+	CouponCode     string            `json:"coupon_code,omitempty"`
+	ShippingMethod string            `json:"shipping_method,omitempty"`
+	CartCleared    bool              `json:"cart_cleared"`
+
+	// Lines the warehouse could not fill (backordered).
+	Backordered []messages.OrderItem `json:"backordered,omitempty"`
+
+	Message messages.OrderMessage `json:"message"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Unfinished reports whether the checkout saga of the order is still in flight.
+func (o Order) Unfinished() bool {
+	return o.Status == StatusPending || o.Status == StatusAuthorized
+}
+
+// Finished reports whether the order has reached a final status that
+// nothing moves on from.
+func (o Order) Finished() bool {
+	switch o.Status {
+	case StatusDeclined, StatusFailed, StatusFulfilled, StatusBackordered:
+		return true
+	}
+	return false
+}
+
+// Store persists orders.
+type Store interface {
+	// NextID returns a new order ID, unique across restarts for durable stores.
+	NextID() int
+
+	// Save creates or replaces an order.
+	Save(order Order) error
+
+	// Get returns an order. Returns ErrNotFound if missing.
+	Get(orderID int) (Order, error)
+
+	// Update applies fn to an order atomically and saves the result if fn
+	// reports a change. Returns the order as stored, or ErrNotFound.
+	Update(orderID int, fn func(order *Order) bool) (Order, error)
+
+	// Unfinished returns the orders whose checkout saga has not finished.
+	Unfinished() []Order
+
+	// EvictFinished deletes finished orders last updated before cutoff
+	// and reports how many were deleted.
+	EvictFinished(cutoff time.Time) int
+}
+
+// Sweep evicts orders that have been finished for longer than ttl,
+// checking every interval until ctx is cancelled.
+func Sweep(ctx context.Context, store Store, ttl, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if n := store.EvictFinished(time.Now().UTC().Add(-ttl)); n > 0 {
+			log.Printf("Evicted %d finished orders", n)
+		}
+	}
+}
+
+// MemoryStore is an in-memory Store. Orders are lost on restart.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	orders map[int]Order
+	nextID int
+}
+
+// NewMemoryStore creates an empty in-memory order store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders: make(map[int]Order),
+		nextID: 1,
+	}
+}
+
+// NextID returns a new order ID.
+func (s *MemoryStore) NextID() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := s.nextID
+	s.nextID++
+	return id
+}
+
+// Save creates or replaces an order.
+func (s *MemoryStore) Save(order Order) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.put(order)
+	return nil
+}
+
+func (s *MemoryStore) put(order Order) {
+	order.Items = append([]models.CartItem(nil), order.Items...)
+	s.orders[order.OrderID] = order
+	if order.OrderID >= s.nextID {
+		s.nextID = order.OrderID + 1
+	}
+}
+
+// Get returns an order. Returns ErrNotFound if missing.
+func (s *MemoryStore) Get(orderID int) (Order, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	return order, nil
+}
+
+// Update applies fn to an order and saves it if fn reports a change.
+func (s *MemoryStore) Update(orderID int, fn func(order *Order) bool) (Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order, ok := s.orders[orderID]
+	if !ok {
+		return Order{}, ErrNotFound
+	}
+	if fn(&order) {
+		s.put(order)
+	}
+	return order, nil
+}
+
+// Unfinished returns the orders whose checkout saga has not finished.
+func (s *MemoryStore) Unfinished() []Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []Order
+	for _, order := range s.orders {
+		if order.Unfinished() {
+			out = append(out, order)
+		}
+	}
+	return out
+}
+
+// EvictFinished deletes finished orders last updated before cutoff.
+func (s *MemoryStore) EvictFinished(cutoff time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.evictLocked(cutoff)
+}
+
+// evictLocked deletes finished orders last updated before cutoff; the
+// caller must hold s.mu. The newest order is kept so that a durable
+// store still knows the next order ID after a restart.
+func (s *MemoryStore) evictLocked(cutoff time.Time) int {
+	newest := 0
+	for id := range s.orders {
+		newest = max(newest, id)
+	}
+
+	evicted := 0
+	for id, order := range s.orders {
+		if id == newest || !order.Finished() || !order.UpdatedAt.Before(cutoff) {
+			continue
+		}
+		delete(s.orders, id)
+		evicted++
+	}
+	return evicted
+}
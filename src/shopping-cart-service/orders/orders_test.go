@@ -0,0 +1,51 @@
+package orders
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvictFinished(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.jsonl")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	for id, status := range []Status{StatusQueued, StatusFailed, StatusDeclined, StatusReceived, StatusFulfilled, StatusBackordered, StatusFailed} {
+		if err := s.Save(Order{OrderID: id + 1, Status: status, UpdatedAt: old}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Save(Order{OrderID: 8, Status: StatusFulfilled, UpdatedAt: time.Now().UTC()}); err != nil {
+		t.Fatal(err)
+	}
+	// The newest order (8) is recent; 7 is old and finished but not the newest either
+	if n := s.EvictFinished(time.Now().UTC().Add(-time.Hour)); n != 5 {
+		t.Fatalf("evicted %d orders, want 5", n)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for id, want := range map[int]bool{1: true, 2: false, 3: false, 4: true, 5: false, 6: false, 7: false, 8: true} {
+		_, err := s.Get(id)
+		if got := err == nil; got != want {
+			t.Errorf("order %d kept = %v, want %v", id, got, want)
+		}
+	}
+	if id := s.NextID(); id != 9 {
+		t.Errorf("NextID after restart = %d, want 9", id)
+	}
+
+	// The newest order is kept even when it is finished and old
+	if n := s.EvictFinished(time.Now().UTC().Add(time.Hour)); n != 0 {
+		t.Errorf("evicted %d orders, want 0 (only the newest is finished)", n)
+	}
+}
@@ -0,0 +1,186 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"shopping-cart-service/models"
+	"shopping-cart-service/products"
+	"shopping-cart-service/promotions"
+	"shopping-cart-service/shipping"
+)
+
+// ErrMixedCurrency is returned when a cart holds products priced in
+// different currencies.
+var ErrMixedCurrency = errors.New("cart contains products priced in different currencies")
+
+// ErrAmountTooLarge is returned when a line or the subtotal exceeds MaxAmount.
+var ErrAmountTooLarge = errors.New("amount too large")
+
+// ErrWeightTooLarge is returned when the cart's weight overflows an int.
+var ErrWeightTooLarge = errors.New("cart weight too large")
+
+// MaxAmount bounds line totals and the subtotal, in minor units. It leaves
+// room to apply tax in basis points and add shipping without overflowing
+// int64, whatever quantity limits are configured.
+const MaxAmount = math.MaxInt64 / 100000
+
+// LineTotal returns price * quantity, or ErrAmountTooLarge if it exceeds
+// MaxAmount.
+func LineTotal(price int64, quantity int) (int64, error) {
+	if quantity > 0 && price > MaxAmount/int64(quantity) {
+		return 0, fmt.Errorf("%w: %d x %d exceeds %d", ErrAmountTooLarge, price, quantity, MaxAmount)
+	}
+	return price * int64(quantity), nil
+}
+
+// Line is a priced cart item. Amounts are in minor units of the quote's
+// currency.
+type Line struct {
+	ProductID int   `json:"product_id"`
+	Quantity  int   `json:"quantity"`
+	UnitPrice int64 `json:"unit_price"`
+	LineTotal int64 `json:"line_total"`
+	Discount  int64 `json:"discount,omitempty"`
+
+	// Product is the product as fetched when the quote was made.
+	Product products.Product `json:"-"`
+}
+
+// Discount is one promotion applied to a quote.
+type Discount struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+	Amount      int64  `json:"amount"`
+}
+
+// Quote is the priced view of a cart. Weight is in grams.
+type Quote struct {
+	Currency       string     `json:"currency,omitempty"`
+	Lines          []Line     `json:"items"`
+	Subtotal       int64      `json:"subtotal"`
+	Discounts      []Discount `json:"discounts,omitempty"`
+	Discount       int64      `json:"discount"`
+	Tax            int64      `json:"tax"`
+	Weight         int        `json:"weight"`
+	ShippingMethod string     `json:"shipping_method"`
+	Shipping       int64      `json:"shipping"`
+	Total          int64      `json:"total"`
+}
+
+// Pricer prices carts using current product prices, promotions and
+// shipping rates.
+type Pricer struct {
+	products   *products.Client
+	promotions *promotions.Engine
+	shipping   *shipping.Quoter
+	taxBPS     int64
+}
+
+// NewPricer creates a Pricer. taxBPS is the tax rate in basis points
+// (800 = 8%) applied to the discounted subtotal; shipping is not taxed.
+func NewPricer(productClient *products.Client, promoEngine *promotions.Engine, shippingQuoter *shipping.Quoter, taxBPS int64) *Pricer {
+	return &Pricer{
+		products:   productClient,
+		promotions: promoEngine,
+		shipping:   shippingQuoter,
+		taxBPS:     taxBPS,
+	}
+}
+
+// Quote fetches every product in the cart and computes subtotal, the
+// discount of the cart's coupon (if any), tax, shipping by total weight
+// and total. Returns ErrMixedCurrency if the products do not share a
+// currency, the product client's error (e.g. products.ErrNotFound), the
+// promotion engine's error for a coupon that cannot be used,
+// ErrAmountTooLarge if a line or the subtotal exceeds MaxAmount,
+// ErrWeightTooLarge if the weight overflows, or the shipping quoter's error.
+func (p *Pricer) Quote(ctx context.Context, cart models.ShoppingCart) (Quote, error) {
+	items := cart.Items
+	coupon := cart.CouponCode
+	quote := Quote{Lines: make([]Line, 0, len(items))}
+
+	for _, item := range items {
+		product, err := p.products.GetProduct(ctx, item.ProductID)
+		if err != nil {
+			return Quote{}, fmt.Errorf("product %d: %w", item.ProductID, err)
+		}
+
+		if quote.Currency == "" {
+			quote.Currency = product.Currency
+		} else if product.Currency != quote.Currency {
+			return Quote{}, ErrMixedCurrency
+		}
+
+		lineTotal, err := LineTotal(product.Price, item.Quantity)
+		if err != nil {
+			return Quote{}, fmt.Errorf("product %d: %w", item.ProductID, err)
+		}
+		if quote.Subtotal > MaxAmount-lineTotal {
+			return Quote{}, fmt.Errorf("%w: subtotal exceeds %d", ErrAmountTooLarge, MaxAmount)
+		}
+
+		line := Line{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			UnitPrice: product.Price,
+			LineTotal: lineTotal,
+			Product:   product,
+		}
+		quote.Lines = append(quote.Lines, line)
+		quote.Subtotal += line.LineTotal
+		if product.Weight > 0 && item.Quantity > (math.MaxInt-quote.Weight)/product.Weight {
+			return Quote{}, fmt.Errorf("%w: product %d", ErrWeightTooLarge, item.ProductID)
+		}
+		quote.Weight += product.Weight * item.Quantity
+	}
+
+	if coupon != "" {
+		promoItems := make([]promotions.Item, len(quote.Lines))
+		for i, line := range quote.Lines {
+			promoItems[i] = promotions.Item{
+				ProductID:  line.ProductID,
+				CategoryID: line.Product.CategoryID,
+				Quantity:   line.Quantity,
+				UnitPrice:  line.UnitPrice,
+			}
+		}
+
+		res, err := p.promotions.Apply(coupon, promoItems, time.Now())
+		if err != nil {
+			return Quote{}, fmt.Errorf("coupon %s: %w", coupon, err)
+		}
+		for i, d := range res.ItemDiscounts {
+			quote.Lines[i].Discount = d
+		}
+		quote.Discounts = append(quote.Discounts, Discount{
+			Code:        res.Code,
+			Description: res.Description,
+			Amount:      res.Amount,
+		})
+		quote.Discount += res.Amount
+	}
+
+	// Round half up to the nearest minor unit
+	taxable := quote.Subtotal - quote.Discount
+	quote.Tax = (taxable*p.taxBPS + 5000) / 10000
+
+	quote.ShippingMethod = cart.ShippingMethod
+	if quote.ShippingMethod == "" {
+		quote.ShippingMethod = p.shipping.DefaultMethod()
+	}
+	cost, err := p.shipping.Quote(quote.ShippingMethod, quote.Weight)
+	if err != nil {
+		return Quote{}, err
+	}
+	// Nothing to ship for an empty cart
+	if len(quote.Lines) > 0 {
+		quote.Shipping = cost
+	}
+
+	quote.Total = taxable + quote.Tax + quote.Shipping
+	return quote, nil
+}
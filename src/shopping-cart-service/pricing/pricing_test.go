@@ -0,0 +1,57 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shopping-cart-service/models"
+	"shopping-cart-service/products"
+	"shopping-cart-service/promotions"
+	"shopping-cart-service/shipping"
+)
+
+func TestLineTotal(t *testing.T) {
+	tests := []struct {
+		price    int64
+		quantity int
+		want     int64
+		err      error
+	}{
+		{250, 4, 1000, nil},
+		{0, math.MaxInt32, 0, nil},
+		{MaxAmount, 1, MaxAmount, nil},
+		{MaxAmount, 2, 0, ErrAmountTooLarge},
+		{math.MaxInt64 / 2, 3, 0, ErrAmountTooLarge},
+		{1 << 40, 1 << 30, 0, ErrAmountTooLarge},
+	}
+	for _, tt := range tests {
+		got, err := LineTotal(tt.price, tt.quantity)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("LineTotal(%d, %d) = %d, %v; want %d, %v", tt.price, tt.quantity, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestQuoteWeightOverflow(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"product_id":1,"price":1,"weight":%d}`, math.MaxInt/2)
+	}))
+	defer srv.Close()
+	p := NewPricer(products.NewClient(srv.URL), promotions.NewEngine(nil), shipping.NewQuoter(shipping.DefaultRates()), 0)
+
+	cart := models.ShoppingCart{Items: []models.CartItem{{ProductID: 1, Quantity: 2}}}
+	quote, err := p.Quote(context.Background(), cart)
+	if err != nil || quote.Weight != math.MaxInt/2*2 {
+		t.Fatalf("Quote = weight %d, %v; want %d", quote.Weight, err, math.MaxInt/2*2)
+	}
+
+	cart.Items[0].Quantity = 3
+	if _, err := p.Quote(context.Background(), cart); !errors.Is(err, ErrWeightTooLarge) {
+		t.Fatalf("Quote of an overflowing weight: error = %v, want ErrWeightTooLarge", err)
+	}
+}
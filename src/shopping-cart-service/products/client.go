@@ -0,0 +1,128 @@
+package products
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"common/tracing"
+)
+
+// ErrNotFound is returned when the product service has no such product.
+var ErrNotFound = errors.New("product not found")
+
+// Product is the subset of the product service's product schema
+// that the shopping cart service relies on.
+type Product struct {
+	ProductID  int    `json:"product_id"`
+	SKU        string `json:"sku"`
+	CategoryID int    `json:"category_id"`
+	Weight     int    `json:"weight"`
+
+	// Price is in minor units of Currency.
+	Price    int64  `json:"price"`
+	Currency string `json:"currency"`
+
+	// MaxPerOrder caps the quantity of this product in one order. 0 means no limit.
+	MaxPerOrder int `json:"max_per_order"`
+}
+
+// defaultCurrency is assumed for products from a product service that
+// predates pricing.
+const defaultCurrency = "USD"
+
+// Retry policy for 5xx responses and connection failures. The product
+// target group mixes healthy and flaky instances, so a retry through the
+// ALB usually lands on a healthy one.
+const (
+	maxAttempts  = 3
+	retryBackoff = 50 * time.Millisecond
+)
+
+// Client fetches products from the product service over HTTP.
+//
+// Every product service instance keeps its own in-memory catalog, and
+// requests go through the ALB to any of them. A product therefore has to be
+// created on every instance (or only one instance run) for lookups to find
+// it consistently; otherwise GetProduct can return ErrNotFound for a product
+// another instance knows.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+	backoff    time.Duration
+}
+
+// NewClient creates a Client for the product service at baseURL
+// (e.g. "http://product-service:8080").
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 2 * time.Second, Transport: tracing.Transport(nil)},
+		backoff:    retryBackoff,
+	}
+}
+
+// errRetryable marks a failure worth retrying: a 5xx response or no
+// response at all.
+type errRetryable struct{ err error }
+
+func (e errRetryable) Error() string { return e.err.Error() }
+func (e errRetryable) Unwrap() error { return e.err }
+
+// GetProduct calls GET /products/{productId}, retrying 5xx responses and
+// connection failures up to maxAttempts times with exponential backoff.
+// Returns ErrNotFound if the product service responds with 404.
+func (c *Client) GetProduct(ctx context.Context, productID int) (Product, error) {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		product, err := c.getProduct(ctx, productID)
+		var retryable errRetryable
+		if err == nil || !errors.As(err, &retryable) || attempt == maxAttempts {
+			return product, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Product{}, err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) getProduct(ctx context.Context, productID int) (Product, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/products/%d", c.baseURL, productID), nil)
+	if err != nil {
+		return Product{}, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return Product{}, fmt.Errorf("failed to contact product service: %w", err)
+		}
+		return Product{}, errRetryable{fmt.Errorf("failed to contact product service: %w", err)}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return Product{}, ErrNotFound
+	}
+	if resp.StatusCode >= 500 {
+		return Product{}, errRetryable{fmt.Errorf("unexpected response from product service (status %d)", resp.StatusCode)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return Product{}, fmt.Errorf("unexpected response from product service (status %d)", resp.StatusCode)
+	}
+
+	var product Product
+	if err := json.NewDecoder(resp.Body).Decode(&product); err != nil {
+		return Product{}, fmt.Errorf("invalid product response: %w", err)
+	}
+	if product.Currency == "" {
+		product.Currency = defaultCurrency
+	}
+	return product, nil
+}
@@ -0,0 +1,76 @@
+package products
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyServer fails the first failures requests with status, then serves
+// product 1.
+func flakyServer(t *testing.T, failures int32, status int) (*Client, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write([]byte(`{"product_id":1,"sku":"SKU-1","price":250}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	c := NewClient(srv.URL)
+	c.backoff = 0
+	return c, &calls
+}
+
+func TestGetProductRetries5xx(t *testing.T) {
+	c, calls := flakyServer(t, maxAttempts-1, http.StatusServiceUnavailable)
+
+	product, err := c.GetProduct(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("GetProduct: %v", err)
+	}
+	if product.Price != 250 || product.Currency != defaultCurrency {
+		t.Errorf("product = %+v", product)
+	}
+	if got := calls.Load(); got != maxAttempts {
+		t.Errorf("%d calls, want %d", got, maxAttempts)
+	}
+}
+
+func TestGetProductGivesUp(t *testing.T) {
+	c, calls := flakyServer(t, maxAttempts, http.StatusInternalServerError)
+
+	if _, err := c.GetProduct(context.Background(), 1); err == nil {
+		t.Fatal("GetProduct succeeded, want error")
+	}
+	if got := calls.Load(); got != maxAttempts {
+		t.Errorf("%d calls, want %d", got, maxAttempts)
+	}
+}
+
+func TestGetProductNoRetry(t *testing.T) {
+	tests := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusNotFound, ErrNotFound},
+		{http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		c, calls := flakyServer(t, 1, tt.status)
+
+		_, err := c.GetProduct(context.Background(), 1)
+		if err == nil || (tt.want != nil && !errors.Is(err, tt.want)) {
+			t.Errorf("status %d: error = %v, want %v", tt.status, err, tt.want)
+		}
+		if got := calls.Load(); got != 1 {
+			t.Errorf("status %d: %d calls, want 1", tt.status, got)
+		}
+	}
+}
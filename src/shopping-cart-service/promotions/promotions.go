@@ -0,0 +1,286 @@
+package promotions
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownCode is returned for a coupon code with no promotion.
+	ErrUnknownCode = errors.New("unknown coupon code")
+
+	// ErrNotActive is returned outside the promotion's validity window.
+	ErrNotActive = errors.New("coupon is not active")
+
+	// ErrUsageLimit is returned once a promotion has been redeemed MaxUses times.
+	ErrUsageLimit = errors.New("coupon usage limit reached")
+
+	// ErrNotApplicable is returned when no item in the cart qualifies.
+	ErrNotApplicable = errors.New("coupon does not apply to any item in the cart")
+)
+
+// Type selects how a promotion computes its discount.
+type Type string
+
+const (
+	// TypePercent takes Percent off every eligible line.
+	TypePercent Type = "percent"
+
+	// TypeFixed takes Amount off the eligible lines, capped at their total.
+	TypeFixed Type = "fixed"
+
+	// TypeBuyXGetY makes GetQuantity of every BuyQuantity+GetQuantity
+	// units of an eligible line free.
+	TypeBuyXGetY Type = "buy_x_get_y"
+)
+
+// Promotion is one coupon. ProductID and CategoryID restrict which lines
+// are eligible; 0 means any. Zero StartsAt/EndsAt leave the window open
+// on that side, and MaxUses 0 means unlimited.
+type Promotion struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+	Type        Type   `json:"type"`
+
+	Percent     int   `json:"percent,omitempty"`
+	Amount      int64 `json:"amount,omitempty"`
+	BuyQuantity int   `json:"buy_quantity,omitempty"`
+	GetQuantity int   `json:"get_quantity,omitempty"`
+
+	ProductID  int `json:"product_id,omitempty"`
+	CategoryID int `json:"category_id,omitempty"`
+
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	MaxUses  int       `json:"max_uses,omitempty"`
+}
+
+// Item is a priced cart line as seen by the engine.
+type Item struct {
+	ProductID  int
+	CategoryID int
+	Quantity   int
+	UnitPrice  int64
+}
+
+// Result is the discount a promotion gives a cart. ItemDiscounts is
+// parallel to the items passed to Apply.
+type Result struct {
+	Code          string
+	Description   string
+	Amount        int64
+	ItemDiscounts []int64
+}
+
+// Engine holds the configured promotions and how often each has been
+// redeemed. Redemption counts are kept in memory.
+type Engine struct {
+	promos map[string]Promotion
+
+	mu   sync.Mutex
+	uses map[string]int
+}
+
+// NewEngine creates an engine for the given promotions. Codes are
+// matched case-insensitively.
+func NewEngine(promos []Promotion) *Engine {
+	e := &Engine{
+		promos: make(map[string]Promotion, len(promos)),
+		uses:   make(map[string]int),
+	}
+	for _, p := range promos {
+		e.promos[normalizeCode(p.Code)] = p
+	}
+	return e
+}
+
+// LoadConfig reads and validates a promotions file: a JSON array of
+// Promotion objects.
+func LoadConfig(path string) ([]Promotion, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var promos []Promotion
+	if err := json.Unmarshal(data, &promos); err != nil {
+		return nil, fmt.Errorf("invalid promotions file: %w", err)
+	}
+
+	seen := make(map[string]bool, len(promos))
+	for i, p := range promos {
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("promotions[%d]: %w", i, err)
+		}
+		code := normalizeCode(p.Code)
+		if seen[code] {
+			return nil, fmt.Errorf("promotions[%d]: duplicate code %q", i, p.Code)
+		}
+		seen[code] = true
+	}
+	return promos, nil
+}
+
+func (p Promotion) validate() error {
+	if normalizeCode(p.Code) == "" {
+		return errors.New("code is required")
+	}
+	switch p.Type {
+	case TypePercent:
+		if p.Percent < 1 || p.Percent > 100 {
+			return errors.New("percent must be between 1 and 100")
+		}
+	case TypeFixed:
+		if p.Amount < 1 {
+			return errors.New("amount must be a positive integer")
+		}
+	case TypeBuyXGetY:
+		if p.BuyQuantity < 1 || p.GetQuantity < 1 {
+			return errors.New("buy_quantity and get_quantity must be positive integers")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", p.Type)
+	}
+	if p.MaxUses < 0 {
+		return errors.New("max_uses must not be negative")
+	}
+	if !p.StartsAt.IsZero() && !p.EndsAt.IsZero() && !p.EndsAt.After(p.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	return nil
+}
+
+// Apply computes the discount of the promotion with the given code on
+// items at time now. It does not count as a use; see Redeem.
+func (e *Engine) Apply(code string, items []Item, now time.Time) (Result, error) {
+	p, err := e.lookup(code, now)
+	if err != nil {
+		return Result{}, err
+	}
+
+	e.mu.Lock()
+	exhausted := p.MaxUses > 0 && e.uses[normalizeCode(code)] >= p.MaxUses
+	e.mu.Unlock()
+	if exhausted {
+		return Result{}, ErrUsageLimit
+	}
+
+	res := Result{
+		Code:          p.Code,
+		Description:   p.Description,
+		ItemDiscounts: make([]int64, len(items)),
+	}
+
+	var eligibleTotal int64
+	for _, item := range items {
+		if p.eligible(item) {
+			eligibleTotal += item.UnitPrice * int64(item.Quantity)
+		}
+	}
+	if eligibleTotal == 0 {
+		return Result{}, ErrNotApplicable
+	}
+
+	// Fixed discounts are spread over eligible lines in proportion to their
+	// totals; the rounding remainder goes to the last eligible line.
+	fixed := p.Amount
+	if fixed > eligibleTotal {
+		fixed = eligibleTotal
+	}
+	last := -1
+
+	for i, item := range items {
+		if !p.eligible(item) {
+			continue
+		}
+		lineTotal := item.UnitPrice * int64(item.Quantity)
+
+		var d int64
+		switch p.Type {
+		case TypePercent:
+			// Round half up to the nearest minor unit
+			d = (lineTotal*int64(p.Percent) + 50) / 100
+		case TypeFixed:
+			d = fixed * lineTotal / eligibleTotal
+			last = i
+		case TypeBuyXGetY:
+			free := item.Quantity / (p.BuyQuantity + p.GetQuantity) * p.GetQuantity
+			d = int64(free) * item.UnitPrice
+		}
+		res.ItemDiscounts[i] = d
+		res.Amount += d
+	}
+	if p.Type == TypeFixed && last >= 0 {
+		res.ItemDiscounts[last] += fixed - res.Amount
+		res.Amount = fixed
+	}
+
+	if res.Amount == 0 {
+		return Result{}, ErrNotApplicable
+	}
+	return res, nil
+}
+
+// Redeem records one use of the promotion, failing if it is inactive or
+// its usage limit has been reached. Call Release if the order is not
+// completed.
+func (e *Engine) Redeem(code string, now time.Time) error {
+	p, err := e.lookup(code, now)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := normalizeCode(code)
+	if p.MaxUses > 0 && e.uses[key] >= p.MaxUses {
+		return ErrUsageLimit
+	}
+	e.uses[key]++
+	return nil
+}
+
+// Release gives back a use taken by Redeem.
+func (e *Engine) Release(code string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	key := normalizeCode(code)
+	if e.uses[key] > 0 {
+		e.uses[key]--
+	}
+}
+
+func (e *Engine) lookup(code string, now time.Time) (Promotion, error) {
+	p, ok := e.promos[normalizeCode(code)]
+	if !ok {
+		return Promotion{}, ErrUnknownCode
+	}
+	if !p.StartsAt.IsZero() && now.Before(p.StartsAt) {
+		return Promotion{}, ErrNotActive
+	}
+	if !p.EndsAt.IsZero() && !now.Before(p.EndsAt) {
+		return Promotion{}, ErrNotActive
+	}
+	return p, nil
+}
+
+func (p Promotion) eligible(item Item) bool {
+	if p.ProductID != 0 && item.ProductID != p.ProductID {
+		return false
+	}
+	if p.CategoryID != 0 && item.CategoryID != p.CategoryID {
+		return false
+	}
+	return true
+}
+
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,169 @@
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var (
+	start = time.Date(2025, time.November, 28, 0, 0, 0, 0, time.UTC)
+	end   = start.Add(72 * time.Hour)
+)
+
+func TestValidityWindow(t *testing.T) {
+	items := []Item{{ProductID: 1, Quantity: 1, UnitPrice: 1000}}
+	tests := []struct {
+		name  string
+		promo Promotion
+		now   time.Time
+		err   error
+	}{
+		{"before start", Promotion{StartsAt: start, EndsAt: end}, start.Add(-time.Second), ErrNotActive},
+		{"at start", Promotion{StartsAt: start, EndsAt: end}, start, nil},
+		{"just before end", Promotion{StartsAt: start, EndsAt: end}, end.Add(-time.Nanosecond), nil},
+		{"at end", Promotion{StartsAt: start, EndsAt: end}, end, ErrNotActive},
+		{"no start", Promotion{EndsAt: end}, start.AddDate(-10, 0, 0), nil},
+		{"no end", Promotion{StartsAt: start}, end.AddDate(10, 0, 0), nil},
+		{"open", Promotion{}, time.Time{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.promo.Code, tt.promo.Type, tt.promo.Percent = "SALE", TypePercent, 10
+			e := NewEngine([]Promotion{tt.promo})
+
+			_, err := e.Apply("SALE", items, tt.now)
+			if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+				t.Errorf("Apply = %v, want %v", err, tt.err)
+			}
+			err = e.Redeem("SALE", tt.now)
+			if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+				t.Errorf("Redeem = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestEligibility(t *testing.T) {
+	items := []Item{
+		{ProductID: 1, CategoryID: 10, Quantity: 2, UnitPrice: 500},
+		{ProductID: 2, CategoryID: 10, Quantity: 1, UnitPrice: 300},
+		{ProductID: 3, CategoryID: 20, Quantity: 1, UnitPrice: 200},
+	}
+	tests := []struct {
+		name  string
+		promo Promotion
+		want  []int64
+		err   error
+	}{
+		{"any item", Promotion{}, []int64{100, 30, 20}, nil},
+		{"product", Promotion{ProductID: 2}, []int64{0, 30, 0}, nil},
+		{"category", Promotion{CategoryID: 10}, []int64{100, 30, 0}, nil},
+		{"product in category", Promotion{ProductID: 3, CategoryID: 20}, []int64{0, 0, 20}, nil},
+		{"product outside category", Promotion{ProductID: 3, CategoryID: 10}, nil, ErrNotApplicable},
+		{"product not in cart", Promotion{ProductID: 9}, nil, ErrNotApplicable},
+		{"category not in cart", Promotion{CategoryID: 30}, nil, ErrNotApplicable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.promo.Code, tt.promo.Type, tt.promo.Percent = "TEN", TypePercent, 10
+			res, err := NewEngine([]Promotion{tt.promo}).Apply("ten", items, start)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Apply = %+v, %v; want %v", res, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var total int64
+			for _, d := range tt.want {
+				total += d
+			}
+			if fmt.Sprint(res.ItemDiscounts) != fmt.Sprint(tt.want) || res.Amount != total {
+				t.Errorf("discounts %v (total %d), want %v (total %d)", res.ItemDiscounts, res.Amount, tt.want, total)
+			}
+		})
+	}
+}
+
+func TestMaxUses(t *testing.T) {
+	e := NewEngine([]Promotion{
+		{Code: "TWICE", Type: TypeFixed, Amount: 100, MaxUses: 2},
+		{Code: "ALWAYS", Type: TypeFixed, Amount: 100},
+	})
+	items := []Item{{ProductID: 1, Quantity: 1, UnitPrice: 1000}}
+
+	// Apply only prices the discount; it does not count as a use
+	for i := 0; i < 3; i++ {
+		if _, err := e.Apply("TWICE", items, start); err != nil {
+			t.Fatalf("Apply %d: %v", i+1, err)
+		}
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := e.Redeem("twice", start); err != nil {
+			t.Fatalf("Redeem %d: %v", i+1, err)
+		}
+	}
+	if err := e.Redeem("TWICE", start); !errors.Is(err, ErrUsageLimit) {
+		t.Fatalf("third Redeem = %v, want ErrUsageLimit", err)
+	}
+	if _, err := e.Apply("TWICE", items, start); !errors.Is(err, ErrUsageLimit) {
+		t.Fatalf("Apply after the limit = %v, want ErrUsageLimit", err)
+	}
+
+	// An order that is not completed gives its use back
+	e.Release("TWICE")
+	if err := e.Redeem("TWICE", start); err != nil {
+		t.Fatalf("Redeem after Release: %v", err)
+	}
+	e.Release("ALWAYS") // never redeemed, must not go negative
+
+	for i := 0; i < 100; i++ {
+		if err := e.Redeem("ALWAYS", start); err != nil {
+			t.Fatalf("unlimited Redeem %d: %v", i+1, err)
+		}
+	}
+	if err := e.Redeem("NOPE", start); !errors.Is(err, ErrUnknownCode) {
+		t.Fatalf("Redeem of an unknown code = %v, want ErrUnknownCode", err)
+	}
+}
+
+func TestPercentRounding(t *testing.T) {
+	tests := []struct {
+		percent int
+		items   []Item
+		want    []int64
+	}{
+		// 149.85 → 150, 150.15 → 150
+		{15, []Item{{Quantity: 1, UnitPrice: 999}}, []int64{150}},
+		{15, []Item{{Quantity: 1, UnitPrice: 1001}}, []int64{150}},
+		// Half a minor unit rounds up
+		{5, []Item{{Quantity: 1, UnitPrice: 10}}, []int64{1}},
+		// Each line is rounded on its own: 0.5 + 0.5 → 1 + 1
+		{10, []Item{{ProductID: 1, Quantity: 1, UnitPrice: 5}, {ProductID: 2, Quantity: 1, UnitPrice: 5}}, []int64{1, 1}},
+		// Rounded on the line total, not the unit price
+		{10, []Item{{Quantity: 3, UnitPrice: 5}}, []int64{2}},
+		{100, []Item{{Quantity: 2, UnitPrice: 333}}, []int64{666}},
+	}
+	for _, tt := range tests {
+		e := NewEngine([]Promotion{{Code: "P", Type: TypePercent, Percent: tt.percent}})
+		res, err := e.Apply("P", tt.items, start)
+		if err != nil {
+			t.Errorf("%d%% of %+v: %v", tt.percent, tt.items, err)
+			continue
+		}
+		if fmt.Sprint(res.ItemDiscounts) != fmt.Sprint(tt.want) {
+			t.Errorf("%d%% of %+v = %v, want %v", tt.percent, tt.items, res.ItemDiscounts, tt.want)
+		}
+	}
+
+	// 0.45 rounds to 0, and a coupon worth nothing does not apply
+	e := NewEngine([]Promotion{{Code: "P", Type: TypePercent, Percent: 5}})
+	if _, err := e.Apply("P", []Item{{Quantity: 1, UnitPrice: 9}}, start); !errors.Is(err, ErrNotApplicable) {
+		t.Errorf("discount rounded to 0: err = %v, want ErrNotApplicable", err)
+	}
+}
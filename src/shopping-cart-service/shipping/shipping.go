@@ -0,0 +1,152 @@
+package shipping
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+)
+
+var (
+	// ErrUnknownMethod is returned for a shipping method with no rate table.
+	ErrUnknownMethod = errors.New("unknown shipping method")
+
+	// ErrOverweight is returned when the weight exceeds every band of the method.
+	ErrOverweight = errors.New("order is too heavy for shipping method")
+)
+
+// Band is one row of a rate table: orders up to MaxWeight grams cost
+// Cost minor units. MaxWeight 0 means no upper bound.
+type Band struct {
+	MaxWeight int   `json:"max_weight"`
+	Cost      int64 `json:"cost"`
+}
+
+// Rates maps shipping methods to their weight bands. DefaultMethod is
+// used for carts that have not chosen a method.
+//
+// Example:
+//
+//	{
+//	  "default_method": "standard",
+//	  "methods": {
+//	    "standard": [{"max_weight": 1000, "cost": 499}, {"max_weight": 0, "cost": 1499}],
+//	    "express":  [{"max_weight": 1000, "cost": 999}, {"max_weight": 0, "cost": 2999}]
+//	  }
+//	}
+type Rates struct {
+	DefaultMethod string            `json:"default_method"`
+	Methods       map[string][]Band `json:"methods"`
+}
+
+// DefaultRates is used when no rates file is configured. Every method ends
+// in an unbounded band so any cart can be priced.
+func DefaultRates() Rates {
+	return Rates{
+		DefaultMethod: "standard",
+		Methods: map[string][]Band{
+			"standard": {
+				{MaxWeight: 1000, Cost: 499},
+				{MaxWeight: 5000, Cost: 899},
+				{MaxWeight: 20000, Cost: 1499},
+				{MaxWeight: 0, Cost: 4999},
+			},
+			"express": {
+				{MaxWeight: 1000, Cost: 999},
+				{MaxWeight: 5000, Cost: 1799},
+				{MaxWeight: 20000, Cost: 2999},
+				{MaxWeight: 0, Cost: 7999},
+			},
+		},
+	}
+}
+
+// LoadRates reads and validates a rates file.
+func LoadRates(path string) (Rates, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Rates{}, err
+	}
+
+	var rates Rates
+	if err := json.Unmarshal(data, &rates); err != nil {
+		return Rates{}, fmt.Errorf("invalid shipping rates file: %w", err)
+	}
+	if err := rates.validate(); err != nil {
+		return Rates{}, err
+	}
+	return rates, nil
+}
+
+func (r Rates) validate() error {
+	if len(r.Methods) == 0 {
+		return errors.New("at least one shipping method is required")
+	}
+	if _, ok := r.Methods[r.DefaultMethod]; !ok {
+		return fmt.Errorf("default_method %q has no rate table", r.DefaultMethod)
+	}
+	for method, bands := range r.Methods {
+		if len(bands) == 0 {
+			return fmt.Errorf("method %q has no bands", method)
+		}
+		for i, b := range bands {
+			if b.MaxWeight < 0 || b.Cost < 0 {
+				return fmt.Errorf("method %q band %d: max_weight and cost must not be negative", method, i)
+			}
+			if b.MaxWeight == 0 && i != len(bands)-1 {
+				return fmt.Errorf("method %q band %d: only the last band may be unbounded", method, i)
+			}
+		}
+	}
+	return nil
+}
+
+// Quoter prices shipping from a rate table.
+type Quoter struct {
+	rates Rates
+}
+
+// NewQuoter creates a Quoter. Bands are sorted by weight, with the
+// unbounded band (if any) last.
+func NewQuoter(rates Rates) *Quoter {
+	sorted := Rates{
+		DefaultMethod: rates.DefaultMethod,
+		Methods:       make(map[string][]Band, len(rates.Methods)),
+	}
+	for method, bands := range rates.Methods {
+		b := append([]Band(nil), bands...)
+		sort.SliceStable(b, func(i, j int) bool {
+			if b[i].MaxWeight == 0 {
+				return false
+			}
+			return b[j].MaxWeight == 0 || b[i].MaxWeight < b[j].MaxWeight
+		})
+		sorted.Methods[method] = b
+	}
+	return &Quoter{rates: sorted}
+}
+
+// DefaultMethod returns the method used when a cart has not chosen one.
+func (q *Quoter) DefaultMethod() string {
+	return q.rates.DefaultMethod
+}
+
+// Quote returns the cost of shipping weight grams with method. An empty
+// method selects the default.
+func (q *Quoter) Quote(method string, weight int) (int64, error) {
+	if method == "" {
+		method = q.rates.DefaultMethod
+	}
+	bands, ok := q.rates.Methods[method]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownMethod, method)
+	}
+
+	for _, b := range bands {
+		if b.MaxWeight == 0 || weight <= b.MaxWeight {
+			return b.Cost, nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q: %dg", ErrOverweight, method, weight)
+}
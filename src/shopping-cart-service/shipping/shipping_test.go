@@ -0,0 +1,54 @@
+package shipping
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDefaultRatesPriceAnyWeight(t *testing.T) {
+	q := NewQuoter(DefaultRates())
+	tests := []struct {
+		method string
+		weight int
+		want   int64
+	}{
+		{"standard", 0, 499},
+		{"standard", 1000, 499},
+		{"standard", 1001, 899},
+		{"standard", 20000, 1499},
+		{"standard", 20001, 4999},
+		{"express", 1_000_000, 7999},
+	}
+	for _, tt := range tests {
+		got, err := q.Quote(tt.method, tt.weight)
+		if err != nil || got != tt.want {
+			t.Errorf("Quote(%s, %d) = %d, %v; want %d", tt.method, tt.weight, got, err, tt.want)
+		}
+	}
+}
+
+func TestOverweight(t *testing.T) {
+	q := NewQuoter(Rates{
+		DefaultMethod: "standard",
+		Methods:       map[string][]Band{"standard": {{MaxWeight: 1000, Cost: 499}}},
+	})
+	if _, err := q.Quote("", 1001); !errors.Is(err, ErrOverweight) {
+		t.Errorf("error = %v, want ErrOverweight", err)
+	}
+	if _, err := q.Quote("express", 1); !errors.Is(err, ErrUnknownMethod) {
+		t.Errorf("error = %v, want ErrUnknownMethod", err)
+	}
+}
+
+func TestExampleRates(t *testing.T) {
+	rates, err := LoadRates("../shipping-rates.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := NewQuoter(rates)
+	for method := range rates.Methods {
+		if _, err := q.Quote(method, 50000); err != nil {
+			t.Errorf("%s cannot price 50kg: %v", method, err)
+		}
+	}
+}
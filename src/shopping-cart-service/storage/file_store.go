@@ -0,0 +1,437 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"shopping-cart-service/models"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.jsonl"
+)
+
+// walRecord is one line of the write-ahead log. Records hold the full
+// state of a cart after a change (or its deletion), so replaying the
+// whole log over the snapshot it follows is idempotent.
+type walRecord struct {
+	Op     string               `json:"op"` // "put" or "delete"
+	Cart   *models.ShoppingCart `json:"cart,omitempty"`
+	CartID int                  `json:"cart_id,omitempty"`
+}
+
+// snapshot is the full store state written by compaction.
+type snapshot struct {
+	NextID int                   `json:"next_id"`
+	Carts  []models.ShoppingCart `json:"carts"`
+}
+
+// FileStore is a durable Store. Carts are served from an in-memory
+// MemoryStore; every change is appended to a write-ahead log in dir, and
+// the log is compacted into a snapshot every snapshotEvery records. On
+// start the snapshot is loaded and the log replayed, so carts survive
+// restarts as long as dir does.
+//
+// Changes to existing carts are computed on a copy and logged before they
+// are applied, so a change that fails to reach the log is not visible
+// either.
+//
+// Methods of Store that cannot return an error (CreateCart,
+// GetOrCreateCart, ExpireIdle) log failed writes instead.
+type FileStore struct {
+	*MemoryStore
+
+	// wmu serializes changes so log order matches the order they were applied.
+	wmu           sync.Mutex
+	dir           string
+	wal           *os.File
+	walSize       int64
+	walRecords    int
+	snapshotEvery int
+	syncWrites    bool
+}
+
+// NewFileStore opens (or creates) a file store in dir. With syncWrites
+// every log append is fsynced before the change is acknowledged.
+func NewFileStore(dir string, snapshotEvery int, syncWrites bool) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	if snapshotEvery < 1 {
+		snapshotEvery = 1000
+	}
+
+	s := &FileStore{
+		MemoryStore:   newMemoryStore(),
+		dir:           dir,
+		snapshotEvery: snapshotEvery,
+		syncWrites:    syncWrites,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+
+	// Fold the replayed log into a fresh snapshot and start an empty log
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load restores the snapshot and replays the write-ahead log.
+func (s *FileStore) load() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFile))
+	switch {
+	case err == nil:
+		var snap snapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return fmt.Errorf("invalid cart snapshot: %w", err)
+		}
+		for i := range snap.Carts {
+			s.restore(&snap.Carts[i])
+		}
+		if snap.NextID > s.nextID {
+			s.nextID = snap.NextID
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, walFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	replayed := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var rec walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			// A torn final line from a crash mid-append; nothing after it was acknowledged
+			log.Printf("WARN: ignoring unreadable cart WAL record %d: %v", replayed+1, err)
+			break
+		}
+		switch {
+		case rec.Op == "put" && rec.Cart != nil:
+			s.restore(rec.Cart)
+		case rec.Op == "delete":
+			s.deleteLocked(rec.CartID)
+		}
+		replayed++
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("reading cart WAL: %w", err)
+	}
+
+	log.Printf("Restored %d carts from %s (%d WAL records replayed)", len(s.carts), s.dir, replayed)
+	return nil
+}
+
+// restore puts a cart into the in-memory state without logging it.
+func (s *FileStore) restore(cart *models.ShoppingCart) {
+	c := *cart
+	if c.Items == nil {
+		c.Items = []models.CartItem{}
+	}
+	s.carts[c.ShoppingCartID] = &c
+	if c.ShoppingCartID >= s.nextID {
+		s.nextID = c.ShoppingCartID + 1
+	}
+	// Rebuild the customer index: the newest cart of each customer wins
+	if c.CustomerID > 0 && c.ShoppingCartID > s.byCustomer[c.CustomerID] {
+		s.byCustomer[c.CustomerID] = c.ShoppingCartID
+	}
+}
+
+// compact writes a snapshot of the current state and truncates the log.
+// The snapshot is renamed into place, so a crash leaves either the old
+// snapshot plus the full log or the new snapshot.
+func (s *FileStore) compact() error {
+	s.mu.RLock()
+	snap := snapshot{NextID: s.nextID, Carts: make([]models.ShoppingCart, 0, len(s.carts))}
+	for _, cart := range s.carts {
+		snap.Carts = append(snap.Carts, *cart.Clone())
+	}
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	if err := writeFileSync(filepath.Join(s.dir, snapshotFile), data); err != nil {
+		return fmt.Errorf("writing cart snapshot: %w", err)
+	}
+
+	if s.wal != nil {
+		_ = s.wal.Close()
+	}
+	wal, err := os.OpenFile(filepath.Join(s.dir, walFile), os.O_CREATE|os.O_TRUNC|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening cart WAL: %w", err)
+	}
+	s.wal = wal
+	s.walSize = 0
+	s.walRecords = 0
+	return nil
+}
+
+// writeFileSync writes data to a temporary file, fsyncs it, renames it
+// over path and fsyncs the directory so the rename itself is durable.
+func writeFileSync(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// append writes records to the log. A failed write is cut back off the log
+// so the next append does not follow a torn line. The caller must hold
+// s.wmu and call compactIfDue once the change is applied in memory.
+func (s *FileStore) append(records ...walRecord) error {
+	if s.wal == nil {
+		return errors.New("cart store is closed")
+	}
+
+	var buf []byte
+	for _, rec := range records {
+		line, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+
+	if _, err := s.wal.Write(buf); err != nil {
+		s.truncateWAL()
+		return fmt.Errorf("appending to cart WAL: %w", err)
+	}
+	if s.syncWrites {
+		if err := s.wal.Sync(); err != nil {
+			s.truncateWAL()
+			return fmt.Errorf("syncing cart WAL: %w", err)
+		}
+	}
+
+	s.walSize += int64(len(buf))
+	s.walRecords += len(records)
+	return nil
+}
+
+// compactIfDue compacts once the log has grown past snapshotEvery records.
+// The caller must hold s.wmu.
+func (s *FileStore) compactIfDue() {
+	if s.walRecords < s.snapshotEvery {
+		return
+	}
+	if err := s.compact(); err != nil {
+		// The changes are still in the log; keep appending and retry next time
+		log.Printf("ERROR: cart snapshot failed: %v", err)
+	}
+}
+
+// truncateWAL drops whatever a failed append left after the last good
+// record.
+func (s *FileStore) truncateWAL() {
+	if err := s.wal.Truncate(s.walSize); err != nil {
+		log.Printf("ERROR: failed to truncate cart WAL after a failed append: %v", err)
+	}
+}
+
+// putRecord captures the current state of a cart.
+func (s *FileStore) putRecord(cartID int) walRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return walRecord{Op: "put", Cart: s.carts[cartID].Clone()}
+}
+
+// logPut appends the current state of a cart that was just changed. The
+// caller must hold s.wmu.
+func (s *FileStore) logPut(cartID int) error {
+	if err := s.append(s.putRecord(cartID)); err != nil {
+		return err
+	}
+	s.compactIfDue()
+	return nil
+}
+
+// CreateCart creates a cart and logs it.
+func (s *FileStore) CreateCart(customerID int) int {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	cartID := s.MemoryStore.CreateCart(customerID)
+	if err := s.logPut(cartID); err != nil {
+		log.Printf("ERROR: failed to persist cart %d: %v", cartID, err)
+	}
+	return cartID
+}
+
+// GetOrCreateCart returns the customer's open cart, logging a newly created one.
+func (s *FileStore) GetOrCreateCart(customerID int) (int, bool) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	cartID, created := s.MemoryStore.GetOrCreateCart(customerID)
+	if created {
+		if err := s.logPut(cartID); err != nil {
+			log.Printf("ERROR: failed to persist cart %d: %v", cartID, err)
+		}
+	}
+	return cartID, created
+}
+
+// update runs fn on a copy of the cart, logs the copy and only then puts
+// it in place of the cart. Holding s.wmu keeps other writers from changing
+// the cart in between.
+func (s *FileStore) update(cartID int, fn func(cart *models.ShoppingCart) error) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	cart, err := s.MemoryStore.GetCart(cartID)
+	if err != nil {
+		return err
+	}
+	if err := fn(cart); err != nil {
+		return err
+	}
+	cart.UpdatedAt = time.Now().UTC()
+
+	if err := s.append(walRecord{Op: "put", Cart: cart}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.carts[cartID] = cart
+	s.mu.Unlock()
+
+	s.compactIfDue()
+	return nil
+}
+
+// AddItem adds an item and logs the cart.
+func (s *FileStore) AddItem(cartID, productID, quantity int) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		return addItem(cart, productID, quantity)
+	})
+}
+
+// SetCoupon sets the coupon and logs the cart.
+func (s *FileStore) SetCoupon(cartID int, code string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		cart.CouponCode = code
+		return nil
+	})
+}
+
+// SetShippingMethod sets the shipping method and logs the cart.
+func (s *FileStore) SetShippingMethod(cartID int, method string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		cart.ShippingMethod = method
+		return nil
+	})
+}
+
+// RemoveItems takes ordered items out of the cart and logs it.
+func (s *FileStore) RemoveItems(cartID int, items []models.CartItem, couponCode string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		return removeItems(cart, items, couponCode)
+	})
+}
+
+// MergeCarts logs the merged target and the source's deletion, then
+// applies both.
+func (s *FileStore) MergeCarts(targetID, sourceID int) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	s.mu.RLock()
+	merged, err := s.mergedLocked(targetID, sourceID)
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	if err := s.append(walRecord{Op: "put", Cart: merged}, walRecord{Op: "delete", CartID: sourceID}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.carts[targetID] = merged
+	s.deleteLocked(sourceID)
+	s.mu.Unlock()
+
+	s.compactIfDue()
+	return nil
+}
+
+// ExpireIdle deletes idle carts and logs their deletion.
+func (s *FileStore) ExpireIdle(cutoff time.Time) []models.ShoppingCart {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	expired := s.MemoryStore.ExpireIdle(cutoff)
+	if len(expired) == 0 {
+		return expired
+	}
+
+	records := make([]walRecord, 0, len(expired))
+	for _, cart := range expired {
+		records = append(records, walRecord{Op: "delete", CartID: cart.ShoppingCartID})
+	}
+	if err := s.append(records...); err != nil {
+		log.Printf("ERROR: failed to persist %d expired carts: %v", len(expired), err)
+	}
+	s.compactIfDue()
+	return expired
+}
+
+// Close writes a final snapshot and closes the log.
+func (s *FileStore) Close() error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+
+	err := s.compact()
+	if s.wal != nil {
+		if cerr := s.wal.Close(); err == nil {
+			err = cerr
+		}
+		s.wal = nil
+	}
+	return err
+}
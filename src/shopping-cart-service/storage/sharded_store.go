@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"shopping-cart-service/models"
+)
+
+// cartEntry is one cart with its own lock. deleted is set (under mu) when
+// the cart is removed, so a caller that looked the entry up just before
+// the removal sees ErrNotFound instead of changing a dead cart.
+type cartEntry struct {
+	mu      sync.Mutex
+	cart    models.ShoppingCart
+	deleted bool
+}
+
+// shard is one partition of the cart map. Its lock only guards map
+// membership; cart contents are guarded by the entry locks.
+type shard struct {
+	mu    sync.RWMutex
+	carts map[int]*cartEntry
+}
+
+// ShardedStore is an in-memory Store partitioned by cart ID into shards,
+// with a lock per cart. Operations on different carts do not contend
+// beyond a brief shard read lock, unlike MemoryStore's single lock.
+//
+// Lock order: the customer index lock is never held while taking a shard
+// or entry lock, except in GetOrCreateCart (index, then shard); entry
+// locks are taken in ascending cart ID order.
+type ShardedStore struct {
+	shards []shard
+	nextID atomic.Int64
+
+	custMu     sync.Mutex
+	byCustomer map[int]int
+}
+
+// NewShardedStore creates a sharded store with n partitions.
+func NewShardedStore(n int) *ShardedStore {
+	if n < 1 {
+		n = 1
+	}
+	s := &ShardedStore{
+		shards:     make([]shard, n),
+		byCustomer: make(map[int]int),
+	}
+	for i := range s.shards {
+		s.shards[i].carts = make(map[int]*cartEntry)
+	}
+	return s
+}
+
+func (s *ShardedStore) shardFor(cartID int) *shard {
+	return &s.shards[cartID%len(s.shards)]
+}
+
+// entry returns the live entry for a cart, or nil.
+func (s *ShardedStore) entry(cartID int) *cartEntry {
+	sh := s.shardFor(cartID)
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	return sh.carts[cartID]
+}
+
+// update runs fn on the cart under its lock and bumps UpdatedAt, unless fn
+// fails.
+func (s *ShardedStore) update(cartID int, fn func(cart *models.ShoppingCart) error) error {
+	e := s.entry(cartID)
+	if e == nil {
+		return ErrNotFound
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.deleted {
+		return ErrNotFound
+	}
+	if err := fn(&e.cart); err != nil {
+		return err
+	}
+	e.cart.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// CreateCart creates a new shopping cart for the given customer ID.
+func (s *ShardedStore) CreateCart(customerID int) int {
+	cartID := s.insert(customerID)
+	if customerID > 0 {
+		s.custMu.Lock()
+		s.byCustomer[customerID] = cartID
+		s.custMu.Unlock()
+	}
+	return cartID
+}
+
+// insert adds a new empty cart and returns its ID.
+func (s *ShardedStore) insert(customerID int) int {
+	cartID := int(s.nextID.Add(1))
+	now := time.Now().UTC()
+	e := &cartEntry{cart: models.ShoppingCart{
+		ShoppingCartID: cartID,
+		CustomerID:     customerID,
+		Items:          []models.CartItem{},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}}
+
+	sh := s.shardFor(cartID)
+	sh.mu.Lock()
+	sh.carts[cartID] = e
+	sh.mu.Unlock()
+	return cartID
+}
+
+// GetOrCreateCart returns the customer's open cart, or creates one.
+func (s *ShardedStore) GetOrCreateCart(customerID int) (int, bool) {
+	s.custMu.Lock()
+	defer s.custMu.Unlock()
+
+	if cartID, ok := s.byCustomer[customerID]; ok {
+		return cartID, false
+	}
+	cartID := s.insert(customerID)
+	s.byCustomer[customerID] = cartID
+	return cartID, true
+}
+
+// CustomerCart returns the customer's most recently created open cart.
+func (s *ShardedStore) CustomerCart(customerID int) (*models.ShoppingCart, error) {
+	s.custMu.Lock()
+	cartID, ok := s.byCustomer[customerID]
+	s.custMu.Unlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.GetCart(cartID)
+}
+
+// GetCart returns a deep copy of the shopping cart with the specified ID.
+func (s *ShardedStore) GetCart(cartID int) (*models.ShoppingCart, error) {
+	e := s.entry(cartID)
+	if e == nil {
+		return nil, ErrNotFound
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.deleted {
+		return nil, ErrNotFound
+	}
+	return e.cart.Clone(), nil
+}
+
+// AddItem adds a new item to the cart, or increments the quantity if the
+// item already exists.
+func (s *ShardedStore) AddItem(cartID, productID, quantity int) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		return addItem(cart, productID, quantity)
+	})
+}
+
+// SetCoupon sets the coupon code applied to the cart.
+func (s *ShardedStore) SetCoupon(cartID int, code string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		cart.CouponCode = code
+		return nil
+	})
+}
+
+// SetShippingMethod sets the shipping method of the cart.
+func (s *ShardedStore) SetShippingMethod(cartID int, method string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		cart.ShippingMethod = method
+		return nil
+	})
+}
+
+// RemoveItems takes ordered items and their coupon out of the cart.
+func (s *ShardedStore) RemoveItems(cartID int, items []models.CartItem, couponCode string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		return removeItems(cart, items, couponCode)
+	})
+}
+
+// MergeCarts moves the items of the source cart into the target cart and
+// deletes the source, with the same rules as MemoryStore.MergeCarts.
+func (s *ShardedStore) MergeCarts(targetID, sourceID int) error {
+	if targetID == sourceID {
+		return ErrNotFound
+	}
+	target, source := s.entry(targetID), s.entry(sourceID)
+	if target == nil || source == nil {
+		return ErrNotFound
+	}
+
+	first, second := target, source
+	if sourceID < targetID {
+		first, second = source, target
+	}
+	first.mu.Lock()
+	second.mu.Lock()
+
+	if target.deleted || source.deleted {
+		second.mu.Unlock()
+		first.mu.Unlock()
+		return ErrNotFound
+	}
+	if source.cart.CustomerID != 0 && source.cart.CustomerID != target.cart.CustomerID {
+		second.mu.Unlock()
+		first.mu.Unlock()
+		return ErrCustomerMismatch
+	}
+
+	merged := target.cart.Clone()
+	if err := mergeCart(merged, &source.cart); err != nil {
+		second.mu.Unlock()
+		first.mu.Unlock()
+		return err
+	}
+	merged.UpdatedAt = time.Now().UTC()
+	target.cart = *merged
+
+	source.deleted = true
+	sourceCustomer := source.cart.CustomerID
+	second.mu.Unlock()
+	first.mu.Unlock()
+
+	s.remove(sourceID, source, sourceCustomer)
+	return nil
+}
+
+// ExpireIdle deletes every cart whose UpdatedAt is before cutoff and
+// returns copies of the deleted carts. Shards are swept one at a time.
+func (s *ShardedStore) ExpireIdle(cutoff time.Time) []models.ShoppingCart {
+	var expired []models.ShoppingCart
+
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		for id, e := range sh.carts {
+			e.mu.Lock()
+			if e.cart.UpdatedAt.Before(cutoff) {
+				expired = append(expired, *e.cart.Clone())
+				e.deleted = true
+				delete(sh.carts, id)
+			}
+			e.mu.Unlock()
+		}
+		sh.mu.Unlock()
+	}
+
+	if len(expired) > 0 {
+		s.custMu.Lock()
+		for _, cart := range expired {
+			if s.byCustomer[cart.CustomerID] == cart.ShoppingCartID {
+				delete(s.byCustomer, cart.CustomerID)
+			}
+		}
+		s.custMu.Unlock()
+	}
+	return expired
+}
+
+// remove drops a cart already marked deleted from its shard and the
+// customer index.
+func (s *ShardedStore) remove(cartID int, e *cartEntry, customerID int) {
+	sh := s.shardFor(cartID)
+	sh.mu.Lock()
+	if sh.carts[cartID] == e {
+		delete(sh.carts, cartID)
+	}
+	sh.mu.Unlock()
+
+	s.custMu.Lock()
+	if s.byCustomer[customerID] == cartID {
+		delete(s.byCustomer, customerID)
+	}
+	s.custMu.Unlock()
+}
@@ -2,7 +2,9 @@ package storage
 
 import (
 	"errors"
+	"math"
 	"sync"
+	"time"
 
 	"shopping-cart-service/models"
 )
@@ -10,21 +12,60 @@ import (
 // Returned when a shopping cart cannot be found in the store.
 var ErrNotFound = errors.New("shopping cart not found")
 
+// Returned by MergeCarts when the source cart belongs to another customer.
+var ErrCustomerMismatch = errors.New("shopping cart belongs to another customer")
+
+// Returned by RemoveItems when the cart no longer holds the items to remove.
+var ErrCartChanged = errors.New("shopping cart no longer holds the items")
+
+// Returned by AddItem and MergeCarts when a line's quantity would overflow.
+var ErrQuantityOverflow = errors.New("item quantity too large")
+
 // Store defines the required operations for managing shopping carts.
-// MemoryStore implements this interface.
+// MemoryStore, ShardedStore and FileStore implement this interface.
 type Store interface {
 	// CreateCart creates a new shopping cart for the given customer
 	// and returns the generated cart ID.
 	CreateCart(customerID int) int
 
-	// GetCart retrieves an existing cart. Returns ErrNotFound if missing.
+	// GetOrCreateCart returns the customer's open cart, creating one if
+	// there is none. created reports whether a new cart was made.
+	GetOrCreateCart(customerID int) (cartID int, created bool)
+
+	// CustomerCart returns a copy of the customer's most recently created
+	// open cart. Returns ErrNotFound if the customer has none.
+	CustomerCart(customerID int) (*models.ShoppingCart, error)
+
+	// GetCart retrieves a copy of an existing cart; changing it does not
+	// change the stored cart. Returns ErrNotFound if missing.
 	GetCart(cartID int) (*models.ShoppingCart, error)
 
-	// AddItem adds a product to the cart or increases quantity if it already exists.
+	// AddItem adds a product to the cart or increases quantity if it already
+	// exists. Returns ErrQuantityOverflow if the quantity would overflow.
 	AddItem(cartID, productID, quantity int) error
 
-	// ClearCart removes all items from the specified cart.
-	ClearCart(cartID int) error
+	// SetCoupon sets the coupon code applied to the cart. An empty code removes it.
+	SetCoupon(cartID int, code string) error
+
+	// SetShippingMethod sets the shipping method of the cart. An empty method selects the default.
+	SetShippingMethod(cartID int, method string) error
+
+	// RemoveItems takes the given quantities out of the cart, dropping
+	// lines that reach zero, and removes the coupon if it is still
+	// couponCode. Items added after the cart was read stay in the cart.
+	// Returns ErrCartChanged, changing nothing, if the cart holds less of
+	// any product than is to be removed.
+	RemoveItems(cartID int, items []models.CartItem, couponCode string) error
+
+	// MergeCarts moves the items of the source cart into the target cart,
+	// adding quantities of products in both, and deletes the source. The
+	// source must be a guest cart (CustomerID 0) or belong to the target's
+	// customer, otherwise ErrCustomerMismatch is returned. Returns
+	// ErrQuantityOverflow, changing nothing, if a quantity would overflow.
+	MergeCarts(targetID, sourceID int) error
+
+	// ExpireIdle deletes every cart last updated before cutoff and returns them.
+	ExpireIdle(cutoff time.Time) []models.ShoppingCart
 }
 
 // MemoryStore is an in-memory implementation of Store.
@@ -33,14 +74,22 @@ type MemoryStore struct {
 	carts  map[int]*models.ShoppingCart
 	nextID int
 	mu     sync.RWMutex
+
+	// byCustomer maps a customer ID to their most recently created cart.
+	byCustomer map[int]int
 }
 
 // NewMemoryStore creates and returns a new in-memory cart store.
 // It returns the Store interface, hiding the concrete implementation.
 func NewMemoryStore() Store {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *MemoryStore {
 	return &MemoryStore{
-		carts:  make(map[int]*models.ShoppingCart),
-		nextID: 1,
+		carts:      make(map[int]*models.ShoppingCart),
+		nextID:     1,
+		byCustomer: make(map[int]int),
 	}
 }
 
@@ -50,20 +99,57 @@ func (s *MemoryStore) CreateCart(customerID int) int {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	return s.createCartLocked(customerID)
+}
+
+// createCartLocked creates a cart; the caller must hold s.mu.
+func (s *MemoryStore) createCartLocked(customerID int) int {
 	cartID := s.nextID
 	s.nextID++
 
+	now := time.Now().UTC()
 	s.carts[cartID] = &models.ShoppingCart{
 		ShoppingCartID: cartID,
 		CustomerID:     customerID,
 		Items:          []models.CartItem{},
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	// Guest carts (customer 0) are not indexed
+	if customerID > 0 {
+		s.byCustomer[customerID] = cartID
 	}
 
 	return cartID
 }
 
-// GetCart returns the shopping cart with the specified ID.
-// If the cart does not exist, ErrNotFound is returned.
+// GetOrCreateCart returns the customer's open cart, or creates one.
+func (s *MemoryStore) GetOrCreateCart(customerID int) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if cartID, ok := s.byCustomer[customerID]; ok {
+		return cartID, false
+	}
+	return s.createCartLocked(customerID), true
+}
+
+// CustomerCart returns the customer's most recently created open cart.
+// Returns ErrNotFound if the customer has none.
+func (s *MemoryStore) CustomerCart(customerID int) (*models.ShoppingCart, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cartID, ok := s.byCustomer[customerID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return s.carts[cartID].Clone(), nil
+}
+
+// GetCart returns a deep copy of the shopping cart with the specified ID,
+// so callers can read it after the lock is released while other requests
+// change the cart. If the cart does not exist, ErrNotFound is returned.
 func (s *MemoryStore) GetCart(cartID int) (*models.ShoppingCart, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -72,48 +158,192 @@ func (s *MemoryStore) GetCart(cartID int) (*models.ShoppingCart, error) {
 	if !exists {
 		return nil, ErrNotFound
 	}
-	return cart, nil
+	return cart.Clone(), nil
+}
+
+// update runs fn on the cart under the lock and bumps UpdatedAt, unless fn
+// fails. Returns ErrNotFound if the cart does not exist.
+func (s *MemoryStore) update(cartID int, fn func(cart *models.ShoppingCart) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cart, exists := s.carts[cartID]
+	if !exists {
+		return ErrNotFound
+	}
+	if err := fn(cart); err != nil {
+		return err
+	}
+	cart.UpdatedAt = time.Now().UTC()
+	return nil
 }
 
 // AddItem adds a new item to the cart, or increments the quantity
 // if the item already exists. Returns ErrNotFound if the cart doesn't exist.
 func (s *MemoryStore) AddItem(cartID, productID, quantity int) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		return addItem(cart, productID, quantity)
+	})
+}
+
+// SetCoupon sets the coupon code applied to the cart.
+// Returns ErrNotFound if the cart does not exist.
+func (s *MemoryStore) SetCoupon(cartID int, code string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		cart.CouponCode = code
+		return nil
+	})
+}
+
+// SetShippingMethod sets the shipping method of the cart.
+// Returns ErrNotFound if the cart does not exist.
+func (s *MemoryStore) SetShippingMethod(cartID int, method string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		cart.ShippingMethod = method
+		return nil
+	})
+}
+
+// RemoveItems takes ordered items and their coupon out of the cart.
+// Returns ErrNotFound if the cart does not exist.
+func (s *MemoryStore) RemoveItems(cartID int, items []models.CartItem, couponCode string) error {
+	return s.update(cartID, func(cart *models.ShoppingCart) error {
+		return removeItems(cart, items, couponCode)
+	})
+}
+
+// MergeCarts moves the items of the source cart into the target cart and
+// deletes the source. The target keeps its own coupon and shipping
+// method, taking the source's only where it has none.
+func (s *MemoryStore) MergeCarts(targetID, sourceID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	merged, err := s.mergedLocked(targetID, sourceID)
+	if err != nil {
+		return err
+	}
+	s.carts[targetID] = merged
+	s.deleteLocked(sourceID)
+	return nil
+}
+
+// mergedLocked returns a copy of the target cart with the source merged
+// into it, leaving both carts unchanged. The caller must hold s.mu.
+func (s *MemoryStore) mergedLocked(targetID, sourceID int) (*models.ShoppingCart, error) {
+	target, exists := s.carts[targetID]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	source, exists := s.carts[sourceID]
+	if !exists || sourceID == targetID {
+		return nil, ErrNotFound
+	}
+	if source.CustomerID != 0 && source.CustomerID != target.CustomerID {
+		return nil, ErrCustomerMismatch
+	}
+
+	merged := target.Clone()
+	if err := mergeCart(merged, source); err != nil {
+		return nil, err
+	}
+	merged.UpdatedAt = time.Now().UTC()
+	return merged, nil
+}
+
+// ExpireIdle deletes every cart whose UpdatedAt is before cutoff and
+// returns copies of the deleted carts.
+func (s *MemoryStore) ExpireIdle(cutoff time.Time) []models.ShoppingCart {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	var expired []models.ShoppingCart
+	for id, cart := range s.carts {
+		if cart.UpdatedAt.Before(cutoff) {
+			expired = append(expired, *cart.Clone())
+			s.deleteLocked(id)
+		}
+	}
+	return expired
+}
+
+// deleteLocked removes a cart and its customer index entry; the caller
+// must hold s.mu.
+func (s *MemoryStore) deleteLocked(cartID int) {
 	cart, exists := s.carts[cartID]
 	if !exists {
-		return ErrNotFound
+		return
 	}
+	if s.byCustomer[cart.CustomerID] == cartID {
+		delete(s.byCustomer, cart.CustomerID)
+	}
+	delete(s.carts, cartID)
+}
 
-	// Check if item already exists; if so, increase quantity.
+// addItem adds quantity of a product to the cart, increasing the quantity
+// of its line if it already has one. The cart is left unchanged if the
+// line's quantity would overflow.
+func addItem(cart *models.ShoppingCart, productID, quantity int) error {
 	for i, item := range cart.Items {
 		if item.ProductID == productID {
+			if quantity > math.MaxInt-item.Quantity {
+				return ErrQuantityOverflow
+			}
 			cart.Items[i].Quantity += quantity
 			return nil
 		}
 	}
-
-	// Otherwise, add a new item to the cart.
 	cart.Items = append(cart.Items, models.CartItem{
 		ProductID: productID,
 		Quantity:  quantity,
 	})
-
 	return nil
 }
 
-// ClearCart removes all items from the specified cart.
-// Returns ErrNotFound if the cart does not exist.
-func (s *MemoryStore) ClearCart(cartID int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// removeItems takes items out of the cart and the coupon if it is still
+// couponCode. The cart is left unchanged if it holds less of any product
+// than is to be removed.
+func removeItems(cart *models.ShoppingCart, items []models.CartItem, couponCode string) error {
+	remaining := make(map[int]int, len(cart.Items))
+	for _, item := range cart.Items {
+		remaining[item.ProductID] += item.Quantity
+	}
+	for _, item := range items {
+		if remaining[item.ProductID] < item.Quantity {
+			return ErrCartChanged
+		}
+		remaining[item.ProductID] -= item.Quantity
+	}
 
-	cart, exists := s.carts[cartID]
-	if !exists {
-		return ErrNotFound
+	kept := []models.CartItem{}
+	for _, item := range cart.Items {
+		if n := remaining[item.ProductID]; n > 0 {
+			kept = append(kept, models.CartItem{ProductID: item.ProductID, Quantity: n})
+			remaining[item.ProductID] = 0
+		}
+	}
+	cart.Items = kept
+	if cart.CouponCode == couponCode {
+		cart.CouponCode = ""
 	}
+	return nil
+}
 
-	cart.Items = []models.CartItem{}
+// mergeCart adds the source's items to the target. The target keeps its
+// own coupon and shipping method, taking the source's only where it has
+// none. On ErrQuantityOverflow the target is partly merged, so callers
+// merge into a copy.
+func mergeCart(target, source *models.ShoppingCart) error {
+	for _, item := range source.Items {
+		if err := addItem(target, item.ProductID, item.Quantity); err != nil {
+			return err
+		}
+	}
+	if target.CouponCode == "" {
+		target.CouponCode = source.CouponCode
+	}
+	if target.ShippingMethod == "" {
+		target.ShippingMethod = source.ShippingMethod
+	}
 	return nil
 }
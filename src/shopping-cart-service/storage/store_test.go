@@ -0,0 +1,396 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"shopping-cart-service/models"
+)
+
+// stores opens one of each Store implementation.
+var stores = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+	{"file", func(t *testing.T) Store { return openFileStore(t, t.TempDir(), 1000) }},
+	{"sharded", func(t *testing.T) Store { return NewShardedStore(4) }},
+}
+
+func openFileStore(t *testing.T, dir string, snapshotEvery int) *FileStore {
+	t.Helper()
+	s, err := NewFileStore(dir, snapshotEvery, true)
+	if err != nil {
+		t.Fatalf("NewFileStore: %v", err)
+	}
+	t.Cleanup(func() {
+		if s.wal != nil {
+			s.Close()
+		}
+	})
+	return s
+}
+
+func getCart(t *testing.T, s Store, cartID int) *models.ShoppingCart {
+	t.Helper()
+	cart, err := s.GetCart(cartID)
+	if err != nil {
+		t.Fatalf("GetCart(%d): %v", cartID, err)
+	}
+	return cart
+}
+
+func mustDo(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sameCart compares carts by their JSON form, which is what FileStore persists.
+func sameCart(t *testing.T, got, want *models.ShoppingCart) {
+	t.Helper()
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if string(g) != string(w) {
+		t.Errorf("cart = %s, want %s", g, w)
+	}
+}
+
+func TestStore(t *testing.T) {
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("create", func(t *testing.T) { testCreate(t, tt.open(t)) })
+			t.Run("add", func(t *testing.T) { testAdd(t, tt.open(t)) })
+			t.Run("merge", func(t *testing.T) { testMerge(t, tt.open(t)) })
+			t.Run("overflow", func(t *testing.T) { testOverflow(t, tt.open(t)) })
+			t.Run("remove items", func(t *testing.T) { testRemoveItems(t, tt.open(t)) })
+			t.Run("expire", func(t *testing.T) { testExpire(t, tt.open(t)) })
+			t.Run("customer index", func(t *testing.T) { testCustomerIndex(t, tt.open(t)) })
+		})
+	}
+}
+
+func testCreate(t *testing.T, s Store) {
+	guest := s.CreateCart(0)
+	customer := s.CreateCart(7)
+	if guest == customer {
+		t.Fatalf("CreateCart returned %d twice", guest)
+	}
+
+	cart := getCart(t, s, customer)
+	if cart.ShoppingCartID != customer || cart.CustomerID != 7 || cart.Items == nil || len(cart.Items) != 0 {
+		t.Errorf("new cart = %+v", cart)
+	}
+	if cart.CreatedAt.IsZero() || !cart.UpdatedAt.Equal(cart.CreatedAt) {
+		t.Errorf("new cart timestamps = %v, %v", cart.CreatedAt, cart.UpdatedAt)
+	}
+	if _, err := s.GetCart(customer + 100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetCart(unknown) error = %v, want ErrNotFound", err)
+	}
+}
+
+func testAdd(t *testing.T, s Store) {
+	id := s.CreateCart(7)
+	before := getCart(t, s, id)
+
+	mustDo(t, s.AddItem(id, 1, 2))
+	mustDo(t, s.AddItem(id, 2, 1))
+	mustDo(t, s.AddItem(id, 1, 3))
+	mustDo(t, s.SetCoupon(id, "SAVE10"))
+	mustDo(t, s.SetShippingMethod(id, "express"))
+
+	cart := getCart(t, s, id)
+	want := []models.CartItem{{ProductID: 1, Quantity: 5}, {ProductID: 2, Quantity: 1}}
+	if len(cart.Items) != 2 || cart.Items[0] != want[0] || cart.Items[1] != want[1] {
+		t.Errorf("items = %+v, want %+v", cart.Items, want)
+	}
+	if cart.CouponCode != "SAVE10" || cart.ShippingMethod != "express" {
+		t.Errorf("coupon, shipping = %q, %q", cart.CouponCode, cart.ShippingMethod)
+	}
+	if cart.UpdatedAt.Before(before.UpdatedAt) {
+		t.Errorf("UpdatedAt went back from %v to %v", before.UpdatedAt, cart.UpdatedAt)
+	}
+
+	// GetCart returns a copy
+	cart.Items[0].Quantity = 99
+	if getCart(t, s, id).Items[0].Quantity != 5 {
+		t.Error("changing the returned cart changed the stored cart")
+	}
+
+	for name, err := range map[string]error{
+		"AddItem":           s.AddItem(id+100, 1, 1),
+		"SetCoupon":         s.SetCoupon(id+100, "X"),
+		"SetShippingMethod": s.SetShippingMethod(id+100, "X"),
+		"RemoveItems":       s.RemoveItems(id+100, nil, ""),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s(unknown) error = %v, want ErrNotFound", name, err)
+		}
+	}
+}
+
+func testMerge(t *testing.T, s Store) {
+	target := s.CreateCart(7)
+	guest := s.CreateCart(0)
+	other := s.CreateCart(8)
+
+	mustDo(t, s.AddItem(target, 1, 1))
+	mustDo(t, s.AddItem(guest, 1, 2))
+	mustDo(t, s.AddItem(guest, 3, 1))
+	mustDo(t, s.SetCoupon(guest, "GUEST"))
+	mustDo(t, s.SetShippingMethod(target, "express"))
+	mustDo(t, s.SetShippingMethod(guest, "standard"))
+
+	if err := s.MergeCarts(target, other); !errors.Is(err, ErrCustomerMismatch) {
+		t.Errorf("merging another customer's cart: error = %v, want ErrCustomerMismatch", err)
+	}
+	if err := s.MergeCarts(target, target); !errors.Is(err, ErrNotFound) {
+		t.Errorf("merging a cart into itself: error = %v, want ErrNotFound", err)
+	}
+	if err := s.MergeCarts(target, other+100); !errors.Is(err, ErrNotFound) {
+		t.Errorf("merging an unknown cart: error = %v, want ErrNotFound", err)
+	}
+
+	mustDo(t, s.MergeCarts(target, guest))
+
+	cart := getCart(t, s, target)
+	want := []models.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 3, Quantity: 1}}
+	if len(cart.Items) != 2 || cart.Items[0] != want[0] || cart.Items[1] != want[1] {
+		t.Errorf("merged items = %+v, want %+v", cart.Items, want)
+	}
+	if cart.CouponCode != "GUEST" || cart.ShippingMethod != "express" {
+		t.Errorf("merged coupon, shipping = %q, %q; want GUEST, express", cart.CouponCode, cart.ShippingMethod)
+	}
+	if _, err := s.GetCart(guest); !errors.Is(err, ErrNotFound) {
+		t.Errorf("merged guest cart still exists: %v", err)
+	}
+	if _, err := s.GetCart(other); err != nil {
+		t.Errorf("rejected merge removed the source: %v", err)
+	}
+}
+
+func testOverflow(t *testing.T, s Store) {
+	target := s.CreateCart(7)
+	guest := s.CreateCart(0)
+	mustDo(t, s.AddItem(target, 1, math.MaxInt))
+	mustDo(t, s.AddItem(guest, 2, 1))
+	mustDo(t, s.AddItem(guest, 1, 1))
+
+	if err := s.AddItem(target, 1, 1); !errors.Is(err, ErrQuantityOverflow) {
+		t.Errorf("AddItem past MaxInt: error = %v, want ErrQuantityOverflow", err)
+	}
+	if err := s.MergeCarts(target, guest); !errors.Is(err, ErrQuantityOverflow) {
+		t.Errorf("MergeCarts past MaxInt: error = %v, want ErrQuantityOverflow", err)
+	}
+
+	// Neither cart is changed, not even by the lines merged before the overflow
+	want := []models.CartItem{{ProductID: 1, Quantity: math.MaxInt}}
+	if cart := getCart(t, s, target); len(cart.Items) != 1 || cart.Items[0] != want[0] {
+		t.Errorf("target items = %+v, want %+v", cart.Items, want)
+	}
+	if cart := getCart(t, s, guest); len(cart.Items) != 2 {
+		t.Errorf("guest items = %+v, want both lines", cart.Items)
+	}
+}
+
+func testRemoveItems(t *testing.T, s Store) {
+	id := s.CreateCart(7)
+	mustDo(t, s.AddItem(id, 1, 2))
+	mustDo(t, s.SetCoupon(id, "SAVE10"))
+	mustDo(t, s.SetShippingMethod(id, "express"))
+	ordered := getCart(t, s, id)
+
+	// Added after the cart was read for checkout
+	mustDo(t, s.AddItem(id, 1, 1))
+	mustDo(t, s.AddItem(id, 2, 4))
+
+	mustDo(t, s.RemoveItems(id, ordered.Items, ordered.CouponCode))
+
+	cart := getCart(t, s, id)
+	want := []models.CartItem{{ProductID: 1, Quantity: 1}, {ProductID: 2, Quantity: 4}}
+	if len(cart.Items) != 2 || cart.Items[0] != want[0] || cart.Items[1] != want[1] {
+		t.Errorf("items left = %+v, want %+v", cart.Items, want)
+	}
+	if cart.CouponCode != "" || cart.ShippingMethod != "express" {
+		t.Errorf("coupon, shipping = %q, %q; want none, express", cart.CouponCode, cart.ShippingMethod)
+	}
+
+	// A second checkout of the same items finds them gone
+	before := getCart(t, s, id)
+	if err := s.RemoveItems(id, ordered.Items, ordered.CouponCode); !errors.Is(err, ErrCartChanged) {
+		t.Errorf("removing items twice: error = %v, want ErrCartChanged", err)
+	}
+	sameCart(t, getCart(t, s, id), before)
+
+	// Removing everything leaves an empty cart, and a coupon changed
+	// meanwhile is kept
+	mustDo(t, s.SetCoupon(id, "OTHER"))
+	mustDo(t, s.RemoveItems(id, want, "SAVE10"))
+	cart = getCart(t, s, id)
+	if cart.Items == nil || len(cart.Items) != 0 || cart.CouponCode != "OTHER" {
+		t.Errorf("emptied cart = %+v", cart)
+	}
+}
+
+func testExpire(t *testing.T, s Store) {
+	idle := s.CreateCart(7)
+	cutoff := time.Now().UTC().Add(time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	active := s.CreateCart(8)
+
+	if expired := s.ExpireIdle(cutoff.Add(-time.Hour)); len(expired) != 0 {
+		t.Errorf("expired %d carts before any were idle", len(expired))
+	}
+
+	expired := s.ExpireIdle(cutoff)
+	if len(expired) != 1 || expired[0].ShoppingCartID != idle || expired[0].CustomerID != 7 {
+		t.Fatalf("expired = %+v, want cart %d", expired, idle)
+	}
+	if _, err := s.GetCart(idle); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired cart still exists: %v", err)
+	}
+	if _, err := s.CustomerCart(7); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired cart still indexed for its customer: %v", err)
+	}
+	getCart(t, s, active)
+}
+
+func testCustomerIndex(t *testing.T, s Store) {
+	if _, err := s.CustomerCart(7); !errors.Is(err, ErrNotFound) {
+		t.Errorf("CustomerCart with no carts: error = %v, want ErrNotFound", err)
+	}
+
+	first, created := s.GetOrCreateCart(7)
+	if !created {
+		t.Error("GetOrCreateCart did not create a cart")
+	}
+	again, created := s.GetOrCreateCart(7)
+	if created || again != first {
+		t.Errorf("GetOrCreateCart = %d, %v; want %d, false", again, created, first)
+	}
+
+	newest := s.CreateCart(7)
+	cart, err := s.CustomerCart(7)
+	if err != nil || cart.ShoppingCartID != newest {
+		t.Errorf("CustomerCart = %+v, %v; want cart %d", cart, err, newest)
+	}
+
+	s.CreateCart(0)
+	if _, err := s.CustomerCart(0); !errors.Is(err, ErrNotFound) {
+		t.Errorf("guest carts are indexed: %v", err)
+	}
+}
+
+func TestFileStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := openFileStore(t, dir, 4)
+
+	a := s.CreateCart(7)
+	b := s.CreateCart(0)
+	c := s.CreateCart(8)
+	mustDo(t, s.AddItem(a, 1, 2))
+	mustDo(t, s.AddItem(b, 2, 1))
+	mustDo(t, s.SetCoupon(a, "SAVE10"))
+	mustDo(t, s.MergeCarts(a, b))
+	mustDo(t, s.SetShippingMethod(c, "express"))
+	mustDo(t, s.AddItem(c, 3, 4))
+
+	if _, err := os.Stat(filepath.Join(dir, snapshotFile)); err != nil {
+		t.Fatalf("no snapshot written: %v", err)
+	}
+	if s.walRecords == 0 {
+		t.Fatal("nothing left in the WAL after the last snapshot")
+	}
+
+	want := map[int]*models.ShoppingCart{a: getCart(t, s, a), c: getCart(t, s, c)}
+
+	// Crash: drop the store without a final snapshot, mid-append of one more record
+	s.wal.Close()
+	s.wal = nil
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"put","cart":{"shopping_cart_id":`)
+	f.Close()
+
+	restarted := openFileStore(t, dir, 4)
+	for id, cart := range want {
+		sameCart(t, getCart(t, restarted, id), cart)
+	}
+	if _, err := restarted.GetCart(b); !errors.Is(err, ErrNotFound) {
+		t.Errorf("merged cart came back: %v", err)
+	}
+	if cart, err := restarted.CustomerCart(7); err != nil || cart.ShoppingCartID != a {
+		t.Errorf("CustomerCart(7) after restart = %+v, %v", cart, err)
+	}
+	if next := restarted.CreateCart(0); next <= c {
+		t.Errorf("cart ID %d reused after restart", next)
+	}
+}
+
+func TestFileStoreFailedAppend(t *testing.T) {
+	s := openFileStore(t, t.TempDir(), 1000)
+	target := s.CreateCart(7)
+	guest := s.CreateCart(0)
+	mustDo(t, s.AddItem(target, 1, 1))
+	mustDo(t, s.AddItem(guest, 2, 1))
+	before := getCart(t, s, target)
+
+	// Every append fails from here on
+	s.wal.Close()
+
+	if err := s.AddItem(target, 1, 5); err == nil {
+		t.Error("AddItem succeeded with a broken WAL")
+	}
+	if err := s.SetCoupon(target, "SAVE10"); err == nil {
+		t.Error("SetCoupon succeeded with a broken WAL")
+	}
+	if err := s.RemoveItems(target, before.Items, ""); err == nil {
+		t.Error("RemoveItems succeeded with a broken WAL")
+	}
+	if err := s.MergeCarts(target, guest); err == nil {
+		t.Error("MergeCarts succeeded with a broken WAL")
+	}
+
+	sameCart(t, getCart(t, s, target), before)
+	getCart(t, s, guest)
+	s.wal = nil
+}
+
+// BenchmarkStore runs a read-heavy mix of cart operations from parallel
+// goroutines, each working on its own cart, to compare lock contention.
+func BenchmarkStore(b *testing.B) {
+	for _, bb := range []struct {
+		name string
+		open func() Store
+	}{
+		{"memory", NewMemoryStore},
+		{"sharded", func() Store { return NewShardedStore(32) }},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			s := bb.open()
+			var next atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				cartID := s.CreateCart(int(next.Add(1)))
+				for i := 0; pb.Next(); i++ {
+					switch i % 4 {
+					case 0:
+						_ = s.AddItem(cartID, i%10+1, 1)
+					case 1:
+						_ = s.SetShippingMethod(cartID, "standard")
+					default:
+						_, _ = s.GetCart(cartID)
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"common/messages"
+	"common/metrics"
+	"common/tracing"
+)
+
+// errNotCapturable 表示授权已经不是 authorized，不能再 capture 或 void（CCA 返回 409），
+// 通常是消息被重复投递。
+var errNotCapturable = errors.New("authorization not capturable")
+
+var (
+	capturesTotal = metrics.NewCounter("warehouse_captures_total",
+		"Authorization captures by result (captured, not_capturable, error).", "result")
+	voidsTotal = metrics.NewCounter("warehouse_voids_total",
+		"Authorization voids of backordered orders by result (voided, not_capturable, error).", "result")
+)
+
+// paymentClient 在订单出库后向 CCA capture 对应的授权，缺货的订单则 void 授权。
+// CCA 出错或连不上时最多调用 attempts 次，第 n 次重试前等 retryDelay 的 2^(n-1) 倍。
+type paymentClient struct {
+	baseURL    string
+	httpClient *http.Client
+	attempts   int
+	retryDelay time.Duration
+}
+
+// newPaymentClient 接受和 shopping-cart-service 相同的 CCA_URL（完整的 authorize 地址），
+// 去掉末尾的 /authorize 得到 authorizations 接口的前缀。timeout 限制每次调用的时间。
+func newPaymentClient(ccaURL string, timeout time.Duration) *paymentClient {
+	return &paymentClient{
+		baseURL:    strings.TrimSuffix(strings.TrimRight(ccaURL, "/"), "/authorize"),
+		httpClient: &http.Client{Timeout: timeout, Transport: tracing.Transport(nil)},
+		attempts:   3,
+		retryDelay: 200 * time.Millisecond,
+	}
+}
+
+// capture 全额 capture 一个授权，请求带上 ctx 里的 traceparent。
+func (c *paymentClient) capture(ctx context.Context, authorizationID string) error {
+	return c.call(ctx, authorizationID, "capture")
+}
+
+// void 释放一个授权的 hold。
+func (c *paymentClient) void(ctx context.Context, authorizationID string) error {
+	return c.call(ctx, authorizationID, "void")
+}
+
+// call 对授权执行一个生命周期操作（capture 或 void）。
+func (c *paymentClient) call(ctx context.Context, authorizationID, action string) error {
+	url := fmt.Sprintf("%s/authorizations/%s/%s", c.baseURL, authorizationID, action)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to contact payment service: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return errNotCapturable
+	default:
+		return fmt.Errorf("unexpected response from payment service (status %d)", resp.StatusCode)
+	}
+}
+
+// captureOrders 并发 capture 一批订单的授权，在整批 ack 之后调用。重试之后还失败
+// 只记录日志：订单已经出库，capture 可以事后补做，不应该让消息重新入队。
+func (c *paymentClient) captureOrders(workerID int, orders []tracedOrder) {
+	c.settle(workerID, orders, "capture", "captured", c.capture, capturesTotal)
+}
+
+// voidOrders 并发 void 缺货订单的授权，同样在 ack 之后调用。没有补货流程，
+// 缺货的订单不会再出库，hold 不释放的话会占着客户的额度，所以失败会重试。
+// 重试之后还失败只记录日志，这种 hold 在 CCA_HOLD_TTL 之后由 CCA 过期并释放额度。
+func (c *paymentClient) voidOrders(workerID int, orders []tracedOrder) {
+	c.settle(workerID, orders, "void", "voided", c.void, voidsTotal)
+}
+
+// settle 对每个订单的授权并发调用 op，结果按 done / not_capturable / error 计入 results。
+func (c *paymentClient) settle(workerID int, orders []tracedOrder, action, done string,
+	op func(ctx context.Context, authorizationID string) error, results *metrics.Counter) {
+	var wg sync.WaitGroup
+	for _, o := range orders {
+		// v1 消息和旧版本 CCA 没有授权 ID
+		if o.order.AuthorizationID == "" {
+			continue
+		}
+		wg.Add(1)
+		go func(ctx context.Context, order messages.OrderMessage) {
+			defer wg.Done()
+			err := c.retry(ctx, func() error { return op(ctx, order.AuthorizationID) })
+			switch {
+			case err == nil:
+				results.Inc(done)
+			case errors.Is(err, errNotCapturable):
+				results.Inc("not_capturable")
+			default:
+				results.Inc("error")
+			}
+			if err != nil {
+				log.Printf("[worker %d] %s %s for order %d failed: %v",
+					workerID, action, order.AuthorizationID, order.OrderID, err)
+			}
+		}(o.ctx, o.order)
+	}
+	wg.Wait()
+}
+
+// retry 调用 op 直到成功、CCA 返回 409 或用完 attempts 次。
+func (c *paymentClient) retry(ctx context.Context, op func() error) error {
+	delay := c.retryDelay
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || errors.Is(err, errNotCapturable) || attempt >= c.attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// poolSize 通过 expvar 暴露当前 worker 数量（GET /debug/vars）。
+var poolSize = expvar.NewInt("warehouse_workers")
+
+// poolConfig 控制 worker 池的伸缩范围和触发条件。
+type poolConfig struct {
+	min      int
+	max      int
+	interval time.Duration
+
+	// 队列深度超过 upBacklog × 当前 worker 数时扩容
+	upBacklog int
+	// 队列非空且平均批处理延迟超过 upLatency 时扩容
+	upLatency time.Duration
+}
+
+// workerPool 管理一组 worker，并根据队列深度和处理延迟在 [min, max] 之间伸缩。
+type workerPool struct {
+	conn     *amqp.Connection
+	batch    batchConfig
+	cfg      poolConfig
+	payments *paymentClient
+	stock    *inventory
+
+	mu      sync.Mutex
+	workers []*worker
+	nextID  int
+	wg      sync.WaitGroup
+
+	// 被动 QueueDeclare 专用的 channel，出错后会重新打开
+	monitor *amqp.Channel
+
+	drainCtx     context.Context
+	stopDraining context.CancelFunc
+	stopScaling  context.CancelFunc
+	scalerDone   chan struct{}
+}
+
+func newWorkerPool(conn *amqp.Connection, batch batchConfig, cfg poolConfig, payments *paymentClient, stock *inventory) *workerPool {
+	drainCtx, stopDraining := context.WithCancel(context.Background())
+	return &workerPool{
+		conn:         conn,
+		batch:        batch,
+		cfg:          cfg,
+		payments:     payments,
+		stock:        stock,
+		drainCtx:     drainCtx,
+		stopDraining: stopDraining,
+	}
+}
+
+// start 启动 initial 个 worker，并在 min < max 时启动 autoscaler。
+func (p *workerPool) start(initial int) error {
+	for i := 0; i < initial; i++ {
+		if err := p.grow(); err != nil {
+			return err
+		}
+	}
+
+	if p.cfg.min < p.cfg.max {
+		ctx, cancel := context.WithCancel(context.Background())
+		p.stopScaling = cancel
+		p.scalerDone = make(chan struct{})
+		go p.autoscale(ctx)
+	}
+	return nil
+}
+
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.workers)
+}
+
+// grow 新增一个 worker。
+func (p *workerPool) grow() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	wk, err := newWorker(p.nextID, p.conn, p.batch, p.payments, p.stock)
+	if err != nil {
+		return err
+	}
+	p.nextID++
+	p.workers = append(p.workers, wk)
+	poolSize.Set(int64(len(p.workers)))
+
+	p.wg.Add(1)
+	go wk.run(p.batch, p.drainCtx, &p.wg)
+	return nil
+}
+
+// shrink 取消最新的一个 worker；它会处理并 ack 完手上的批次后退出。
+func (p *workerPool) shrink() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.workers) == 0 {
+		return
+	}
+	wk := p.workers[len(p.workers)-1]
+	p.workers = p.workers[:len(p.workers)-1]
+	poolSize.Set(int64(len(p.workers)))
+
+	if err := wk.cancel(); err != nil {
+		log.Printf("Failed to cancel consumer %s: %v", wk.tag, err)
+	}
+}
+
+// queueDepth 用被动 QueueDeclare 读取 "orders" 队列中待投递的消息数。
+func (p *workerPool) queueDepth() (int, error) {
+	if p.monitor == nil || p.monitor.IsClosed() {
+		ch, err := p.conn.Channel()
+		if err != nil {
+			return 0, err
+		}
+		p.monitor = ch
+	}
+
+	// 这里不主动 QueueDeclare，完全依赖 Shopping Cart 那边声明好的 "orders" 队列，
+	// 避免 durable / autoDelete 参数不一致导致 PRECONDITION_FAILED。
+	// 被动声明只读取队列深度，队列不存在时返回错误而不是创建它。
+	q, err := p.monitor.QueueDeclarePassive("orders", true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return q.Messages, nil
+}
+
+func (p *workerPool) autoscale(ctx context.Context) {
+	defer close(p.scalerDone)
+
+	ticker := time.NewTicker(p.cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		depth, err := p.queueDepth()
+		if err != nil {
+			log.Printf("[autoscaler] failed to read queue depth: %v", err)
+			continue
+		}
+		latency := takeBatchLatency()
+		size := p.size()
+
+		switch {
+		case size < p.cfg.max && depth > 0 &&
+			(depth > p.cfg.upBacklog*size || latency > p.cfg.upLatency):
+			if err := p.grow(); err != nil {
+				log.Printf("[autoscaler] failed to add worker: %v", err)
+				continue
+			}
+			log.Printf("[autoscaler] queue=%d latency=%s, scaled up to %d workers", depth, latency, size+1)
+
+		case size > p.cfg.min && depth == 0 && latency < p.cfg.upLatency/2:
+			p.shrink()
+			log.Printf("[autoscaler] queue empty, scaled down to %d workers", size-1)
+		}
+	}
+}
+
+// shutdown 停止伸缩、取消所有消费者，并等待 worker 在 timeout 内处理完手上的消息；
+// 超时后剩余的投递会被 nack 重新入队。
+func (p *workerPool) shutdown(timeout time.Duration) {
+	if p.stopScaling != nil {
+		p.stopScaling()
+		<-p.scalerDone
+	}
+	if p.monitor != nil {
+		p.monitor.Close()
+	}
+
+	// 1. 取消消费者：broker 不再推送新消息，已预取的投递处理完后 msgs 会被关闭
+	p.mu.Lock()
+	for _, wk := range p.workers {
+		if err := wk.cancel(); err != nil {
+			log.Printf("Failed to cancel consumer %s: %v", wk.tag, err)
+		}
+	}
+	p.workers = nil
+	poolSize.Set(0)
+	p.mu.Unlock()
+
+	// 2. 等待 worker 在截止时间内处理并 ack 手上的消息
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		// 3. 超时：剩余的投递全部 nack 重新入队，交给其他实例处理
+		log.Printf("Shutdown timeout (%s) exceeded, requeueing remaining deliveries", timeout)
+		p.stopDraining()
+		<-done
+	}
+	p.stopDraining()
+}
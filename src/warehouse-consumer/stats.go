@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"common/messages"
+	"common/metrics"
+)
+
+// counterShards 是商品计数器的分片数，按 productID 取模分配，
+// 避免所有 worker 抢同一把全局锁。
+const counterShards = 32
+
+type counterShard struct {
+	mu     sync.Mutex
+	counts map[int]int64
+}
+
+var (
+	totalOrders     int64
+	productCounters [counterShards]counterShard
+)
+
+func init() {
+	for i := range productCounters {
+		productCounters[i].counts = make(map[int]int64)
+	}
+}
+
+func shardFor(productID int) int {
+	if productID < 0 {
+		productID = -productID
+	}
+	return productID % counterShards
+}
+
+// applyBatch 把一批订单累加到计数器上。
+// 先按分片分组，每个分片只加锁一次。
+func applyBatch(orders []messages.OrderMessage) {
+	if len(orders) == 0 {
+		return
+	}
+	atomic.AddInt64(&totalOrders, int64(len(orders)))
+
+	var grouped [counterShards]map[int]int64
+	for _, order := range orders {
+		for _, item := range order.Items {
+			s := shardFor(item.ProductID)
+			if grouped[s] == nil {
+				grouped[s] = make(map[int]int64)
+			}
+			grouped[s][item.ProductID] += int64(item.Quantity)
+		}
+	}
+
+	for s, delta := range grouped {
+		if delta == nil {
+			continue
+		}
+		shard := &productCounters[s]
+		shard.mu.Lock()
+		for productID, qty := range delta {
+			shard.counts[productID] += qty
+		}
+		shard.mu.Unlock()
+	}
+}
+
+// snapshotCounts 返回所有商品计数的一份拷贝。
+func snapshotCounts() map[int]int64 {
+	out := make(map[int]int64)
+	for i := range productCounters {
+		shard := &productCounters[i]
+		shard.mu.Lock()
+		for productID, qty := range shard.counts {
+			out[productID] = qty
+		}
+		shard.mu.Unlock()
+	}
+	return out
+}
+
+// Prometheus 指标（GET :9090/metrics）
+var (
+	messagesConsumed = metrics.NewCounter("warehouse_messages_consumed_total",
+		"Order messages consumed, by result (processed, parked).", "result")
+	ordersFulfilled = metrics.NewCounter("warehouse_orders_total",
+		"Processed orders by fulfillment status (fulfilled, backordered).", "status")
+	batchDuration = metrics.NewHistogram("warehouse_batch_duration_seconds",
+		"Time from the first message of a batch reaching a worker to the batch being acked and its captures done.",
+		metrics.DefBuckets)
+	orderLatency = metrics.NewHistogram("warehouse_order_latency_seconds",
+		"Time from checkout to the warehouse acking the order (queue wait plus processing).",
+		[]float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300})
+)
+
+func init() {
+	metrics.NewGaugeFunc("warehouse_workers", "Current number of warehouse workers.",
+		func() float64 { return float64(poolSize.Value()) })
+}
+
+// recordOrderLatency 记录一批订单从下单到 ack 的时间；v1 消息没有 created_at，跳过。
+func recordOrderLatency(orders []messages.OrderMessage) {
+	now := time.Now()
+	for _, order := range orders {
+		if !order.CreatedAt.IsZero() {
+			orderLatency.Observe(now.Sub(order.CreatedAt).Seconds())
+		}
+	}
+}
+
+// 批处理延迟：从一批的第一条消息到达 worker 到整批 ack 并且 capture 完成的时间。
+// autoscaler 每个周期读取并清零，用平均值判断是否需要扩容。
+var (
+	latencyNanos   int64
+	latencySamples int64
+)
+
+func recordBatchLatency(d time.Duration) {
+	atomic.AddInt64(&latencyNanos, int64(d))
+	atomic.AddInt64(&latencySamples, 1)
+	batchDuration.Observe(d.Seconds())
+}
+
+// takeBatchLatency 返回上次调用以来的平均批处理延迟，并清零计数。
+func takeBatchLatency() time.Duration {
+	nanos := atomic.SwapInt64(&latencyNanos, 0)
+	samples := atomic.SwapInt64(&latencySamples, 0)
+	if samples == 0 {
+		return 0
+	}
+	return time.Duration(nanos / samples)
+}
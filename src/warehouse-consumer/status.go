@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+	"common/tracing"
+)
+
+// declareStatusExchange 声明订单状态 exchange（topic，durable）。
+// warehouse 是生产者所以自己声明；shopping-cart-service 绑定队列前也用相同参数声明。
+func declareStatusExchange(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	return ch.ExchangeDeclare(
+		messages.OrderStatusExchange,
+		"topic",
+		true,  // durable
+		false, // autoDelete
+		false, // internal
+		false, // noWait
+		nil,
+	)
+}
+
+// tracedOrder 是可以出库的订单，带着它的 consumer span 所在的 context。
+type tracedOrder struct {
+	ctx   context.Context
+	order messages.OrderMessage
+}
+
+// fulfill 对一批订单逐个预留库存并发布状态事件（先 received，再 fulfilled 或 backordered），
+// 返回可以出库的订单和缺货的订单。缺货的订单不出库也不 capture；没有补货流程，
+// 调用方在 ack 之后 void 它们的授权。
+// traces[i] 是 batch[i] 的 trace context，状态事件带上它，shopping-cart-service 处理时接着同一个 trace。
+func (w *worker) fulfill(batch []messages.OrderMessage, traces []context.Context) (fulfilled, backordered []tracedOrder) {
+	fulfilled = make([]tracedOrder, 0, len(batch))
+	for i, order := range batch {
+		ctx := traces[i]
+		w.publishStatus(ctx, order, messages.StatusReceived, nil)
+
+		if short := w.stock.reserve(order.OrderID, order.Items); len(short) > 0 {
+			log.Printf("[worker %d] order %d backordered (%d lines short)", w.id, order.OrderID, len(short))
+			w.publishStatus(ctx, order, messages.StatusBackordered, short)
+			ordersFulfilled.Inc(messages.StatusBackordered)
+			backordered = append(backordered, tracedOrder{ctx: ctx, order: order})
+			continue
+		}
+		w.publishStatus(ctx, order, messages.StatusFulfilled, nil)
+		ordersFulfilled.Inc(messages.StatusFulfilled)
+		fulfilled = append(fulfilled, tracedOrder{ctx: ctx, order: order})
+	}
+	return fulfilled, backordered
+}
+
+// publishStatus 发布一条订单状态事件，routing key 是状态本身。
+// 失败只记录日志：订单已经处理了，状态通知是尽力而为。
+func (w *worker) publishStatus(ctx context.Context, order messages.OrderMessage, status string, backordered []messages.OrderItem) {
+	ctx, span := tracing.Start(ctx, messages.OrderStatusExchange+" publish", tracing.KindProducer)
+	span.SetAttribute("messaging.system", "rabbitmq")
+	span.SetAttribute("messaging.destination.name", messages.OrderStatusExchange)
+	span.SetAttribute("order.status", status)
+	defer span.End()
+
+	event := messages.OrderStatus{
+		Event:         messages.OrderStatusEvent,
+		OrderID:       order.OrderID,
+		Status:        status,
+		CorrelationID: order.CorrelationID,
+		OccurredAt:    time.Now().UTC(),
+		Backordered:   backordered,
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("[worker %d] marshal status event for order %d failed: %v", w.id, order.OrderID, err)
+		span.SetError(err)
+		return
+	}
+	headers := amqp.Table{}
+	tracing.Inject(ctx, headers)
+
+	if err := w.ch.Publish(
+		messages.OrderStatusExchange,
+		status,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			DeliveryMode:  amqp.Persistent,
+			Headers:       headers,
+			CorrelationId: order.CorrelationID,
+			Timestamp:     event.OccurredAt,
+			Body:          body,
+		},
+	); err != nil {
+		log.Printf("[worker %d] publish %s for order %d failed: %v", w.id, status, order.OrderID, err)
+		span.SetError(err)
+	}
+}
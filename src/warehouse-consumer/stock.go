@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"common/messages"
+)
+
+// reservationMemory 是记住预留结果的订单数上限，超过后忘掉最早的。
+// 重复投递一般在几秒内发生，远小于这个窗口。
+const reservationMemory = 100000
+
+// inventory 是仓库的现货数量。只跟踪配置了库存的商品，没配置的商品视为无限库存，
+// 所以不配置 WAREHOUSE_STOCK 时所有订单都能出库。
+type inventory struct {
+	mu     sync.Mutex
+	onHand map[int]int64
+
+	// decided 按订单 ID 记住预留结果（缺货的行，出库的订单为 nil），
+	// 同一个订单重复投递时直接返回上次的结果，不会再扣一次库存。
+	// decidedOrder 是记录的先后顺序，用来淘汰最早的记录。
+	decided      map[int][]messages.OrderItem
+	decidedOrder []int
+}
+
+func newInventory() *inventory {
+	return &inventory{
+		onHand:  make(map[int]int64),
+		decided: make(map[int][]messages.OrderItem),
+	}
+}
+
+// loadInventory 读取 WAREHOUSE_STOCK 指向的 JSON 文件：{"<product_id>": 数量, ...}。
+// path 为空时返回一个空的 inventory（全部无限库存）。
+func loadInventory(path string) (*inventory, error) {
+	inv := newInventory()
+	if path == "" {
+		return inv, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]int64
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid stock file: %w", err)
+	}
+	for key, qty := range raw {
+		productID, err := strconv.Atoi(key)
+		if err != nil || productID < 1 {
+			return nil, fmt.Errorf("invalid product id %q in stock file", key)
+		}
+		if qty < 0 {
+			return nil, fmt.Errorf("product %d: stock must not be negative", productID)
+		}
+		inv.onHand[productID] = qty
+	}
+	return inv, nil
+}
+
+// reserve 整单预留库存：所有行都够才扣减，否则一件都不扣，返回缺货的行。
+// 结果按订单 ID 记下来，同一个订单再来（消息重复投递）时返回相同的结果，库存只扣一次。
+func (inv *inventory) reserve(orderID int, items []messages.OrderItem) []messages.OrderItem {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if short, ok := inv.decided[orderID]; ok {
+		return short
+	}
+	short := inv.reserveLocked(items)
+	inv.decided[orderID] = short
+	inv.decidedOrder = append(inv.decidedOrder, orderID)
+	if len(inv.decidedOrder) > reservationMemory {
+		delete(inv.decided, inv.decidedOrder[0])
+		inv.decidedOrder = inv.decidedOrder[1:]
+	}
+	return short
+}
+
+// reserveLocked 做实际的扣减，调用方持有 inv.mu。
+func (inv *inventory) reserveLocked(items []messages.OrderItem) []messages.OrderItem {
+	// 同一个商品可能出现在多行，先合并再比较
+	wanted := make(map[int]int64)
+	for _, item := range items {
+		wanted[item.ProductID] += int64(item.Quantity)
+	}
+
+	var short []messages.OrderItem
+	for _, item := range items {
+		onHand, tracked := inv.onHand[item.ProductID]
+		if tracked && wanted[item.ProductID] > onHand {
+			short = append(short, item)
+		}
+	}
+	if len(short) > 0 {
+		return short
+	}
+
+	for productID, qty := range wanted {
+		if _, tracked := inv.onHand[productID]; tracked {
+			inv.onHand[productID] -= qty
+		}
+	}
+	return nil
+}
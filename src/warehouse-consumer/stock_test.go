@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+
+	"common/messages"
+)
+
+// TestReserveRedelivery 确认同一个订单重复投递时库存只扣一次，结果和第一次相同。
+func TestReserveRedelivery(t *testing.T) {
+	inv := newInventory()
+	inv.onHand[1] = 3
+	items := []messages.OrderItem{{ProductID: 1, Quantity: 2}}
+
+	if short := inv.reserve(1, items); short != nil {
+		t.Fatalf("order 1 short %v, want filled", short)
+	}
+	if short := inv.reserve(1, items); short != nil {
+		t.Fatalf("redelivered order 1 short %v, want filled", short)
+	}
+	if inv.onHand[1] != 1 {
+		t.Fatalf("on hand %d after one order of 2, want 1", inv.onHand[1])
+	}
+
+	// 订单 2 缺货；重复投递仍然是缺货，不会因为别的变化改变结果
+	if short := inv.reserve(2, items); len(short) != 1 {
+		t.Fatalf("order 2 short %v, want 1 line", short)
+	}
+	inv.onHand[1] = 10
+	if short := inv.reserve(2, items); len(short) != 1 {
+		t.Fatalf("redelivered order 2 short %v, want the first result", short)
+	}
+	if inv.onHand[1] != 10 {
+		t.Fatalf("on hand %d, want 10 untouched", inv.onHand[1])
+	}
+}
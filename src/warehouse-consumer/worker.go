@@ -0,0 +1,252 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+	"common/tracing"
+)
+
+// parkingQueue 存放无法处理的消息（未知 schema 版本或校验失败），留待人工排查或重放。
+const parkingQueue = "orders.parking"
+
+// parkingReasonHeader 记录消息被转入 parking 队列的原因。
+const parkingReasonHeader = "x-parking-reason"
+
+// parkConfirmTimeout 是等待 broker 确认 parking 消息的上限。
+const parkConfirmTimeout = 5 * time.Second
+
+// declareParkingQueue 声明 parking 队列。这个队列只由 warehouse 使用，可以自己声明。
+func declareParkingQueue(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	_, err = ch.QueueDeclare(
+		parkingQueue,
+		true,  // durable
+		false, // autoDelete
+		false, // exclusive
+		false, // noWait
+		nil,
+	)
+	return err
+}
+
+// batchConfig 控制 worker 的预取数量和批量提交的大小/时间上限。
+type batchConfig struct {
+	prefetch int
+	size     int
+	interval time.Duration
+}
+
+// amqpChannel 是 worker 用到的 *amqp.Channel 方法，基准测试里换成假的实现。
+type amqpChannel interface {
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error)
+	Cancel(consumer string, noWait bool) error
+	Close() error
+}
+
+// worker 拥有独立的 channel 和 consumer。
+// Ack(multiple=true) 作用于整个 channel，所以每个 worker 必须单独一个 channel，
+// 否则会把其他 worker 还没处理完的消息一起确认掉。
+type worker struct {
+	id       int
+	tag      string
+	ch       amqpChannel
+	msgs     <-chan amqp.Delivery
+	payments *paymentClient
+	stock    *inventory
+}
+
+func newWorker(id int, conn *amqp.Connection, cfg batchConfig, payments *paymentClient, stock *inventory) (*worker, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("open channel: %w", err)
+	}
+
+	if err := ch.Qos(cfg.prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("set QoS: %w", err)
+	}
+
+	// publisher confirm：parking 消息被 broker 确认之后才能 ack 原消息
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("enable publisher confirms: %w", err)
+	}
+
+	tag := fmt.Sprintf("%s-%d", consumerTag, id)
+	msgs, err := ch.Consume(
+		"orders", // 队列名要和 SCS 使用的一致
+		tag,
+		false, // 手动 ACK
+		false,
+		false,
+		false,
+		nil,
+	)
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("start consuming: %w", err)
+	}
+
+	return &worker{id: id, tag: tag, ch: ch, msgs: msgs, payments: payments, stock: stock}, nil
+}
+
+// cancel 停止 broker 继续推送消息；已预取的投递处理完后 msgs 会被关闭。
+func (w *worker) cancel() error {
+	return w.ch.Cancel(w.tag, false)
+}
+
+// park 把原始消息连同原因一起发布到 parking 队列，并等待 broker 确认。
+// 返回 nil 之后原消息才可以 ack；broker nack 或超时返回错误，调用方把原消息重新入队。
+func (w *worker) park(d amqp.Delivery, reason error) error {
+	headers := amqp.Table{}
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[parkingReasonHeader] = reason.Error()
+
+	ctx, cancel := context.WithTimeout(context.Background(), parkConfirmTimeout)
+	defer cancel()
+	confirm, err := w.ch.PublishWithDeferredConfirmWithContext(
+		ctx,
+		"",
+		parkingQueue,
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  d.ContentType,
+			DeliveryMode: amqp.Persistent,
+			Headers:      headers,
+			Body:         d.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+	if confirm == nil {
+		// channel 不在 confirm 模式（只有测试里的假 channel 会这样）
+		return nil
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("waiting for parking confirm: %w", err)
+	}
+	if !acked {
+		return errors.New("broker nacked the parked message")
+	}
+	return nil
+}
+
+// run 把投递累积成批，达到 cfg.size 条或者每隔 cfg.interval 提交一次：
+// 先更新计数器，按库存出库并发布状态事件，再用 multiple=true 一次性 ack 整批，
+// ack 之后才 capture 出库订单的授权、void 缺货订单的授权，CCA 慢的时候整批消息不会一直挂着不 ack。
+// capture 的时间算进批处理延迟，autoscaler 据此扩容。
+// drainCtx 被取消后（关闭超时），剩余的投递不再处理，而是 nack 并重新入队。
+// 每条消息从 header 里的 traceparent 接上 checkout 的 trace，consumer span 在 capture 之后结束。
+func (w *worker) run(cfg batchConfig, drainCtx context.Context, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer w.ch.Close()
+	log.Printf("[worker %d] started", w.id)
+
+	batch := make([]messages.OrderMessage, 0, cfg.size)
+	traces := make([]context.Context, 0, cfg.size) // 和 batch 一一对应
+	var last amqp.Delivery
+	var batchStart time.Time
+	pending := 0
+
+	flush := func() {
+		if pending == 0 {
+			return
+		}
+		applyBatch(batch)
+		fulfilled, backordered := w.fulfill(batch, traces)
+		if err := last.Ack(true); err != nil {
+			log.Printf("[worker %d] ack failed: %v", w.id, err)
+		}
+		messagesConsumed.Add(float64(len(batch)), "processed")
+		recordOrderLatency(batch)
+
+		w.payments.captureOrders(w.id, fulfilled)
+		w.payments.voidOrders(w.id, backordered)
+		for _, ctx := range traces {
+			tracing.FromContext(ctx).End()
+		}
+		recordBatchLatency(time.Since(batchStart))
+		batch = batch[:0]
+		traces = traces[:0]
+		pending = 0
+	}
+
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case d, ok := <-w.msgs:
+			if !ok {
+				flush()
+				log.Printf("[worker %d] stopped (msgs channel closed)", w.id)
+				return
+			}
+
+			if drainCtx.Err() != nil {
+				flush()
+				if err := d.Nack(false, true); err != nil {
+					log.Printf("[worker %d] nack failed: %v", w.id, err)
+				}
+				continue
+			}
+
+			ctx, span := tracing.Start(tracing.Extract(context.Background(), d.Headers), "orders process", tracing.KindConsumer)
+			span.SetAttribute("messaging.system", "rabbitmq")
+			span.SetAttribute("messaging.destination.name", "orders")
+
+			order, err := messages.Decode(d.Headers, d.Body)
+			if err != nil {
+				// 无法处理的消息转到 parking 队列，原消息随下一批一起 ack 掉
+				log.Printf("[worker %d] parking message: %v", w.id, err)
+				span.SetError(err)
+				span.End()
+				if err := w.park(d, err); err != nil {
+					// 转存失败时不能 ack，否则消息就丢了；先提交已有的批，再重新入队
+					log.Printf("[worker %d] park failed, requeueing: %v", w.id, err)
+					flush()
+					if err := d.Nack(false, true); err != nil {
+						log.Printf("[worker %d] nack failed: %v", w.id, err)
+					}
+					continue
+				}
+				messagesConsumed.Inc("parked")
+			} else {
+				span.SetAttribute("order.id", order.OrderID)
+				batch = append(batch, order)
+				traces = append(traces, ctx)
+			}
+			if pending == 0 {
+				batchStart = time.Now()
+			}
+			last = d
+			pending++
+
+			if pending >= cfg.size {
+				flush()
+			}
+
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
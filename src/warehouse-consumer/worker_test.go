@@ -0,0 +1,388 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"common/messages"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// fakeChannel 代替 *amqp.Channel，只记录发布的消息。
+type fakeChannel struct {
+	mu        sync.Mutex
+	published []amqp.Publishing
+}
+
+func (c *fakeChannel) Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, msg)
+	return nil
+}
+
+// PublishWithDeferredConfirmWithContext 和不在 confirm 模式的 channel 一样返回 nil 的确认。
+func (c *fakeChannel) PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	return nil, c.Publish(exchange, key, mandatory, immediate, msg)
+}
+
+func (c *fakeChannel) Cancel(string, bool) error { return nil }
+func (c *fakeChannel) Close() error              { return nil }
+
+// frameConn 模拟 AMQP 连接：所有 channel 共用一条 TCP 连接，帧按顺序写出，
+// 和真实连接一样每个帧一次写系统调用。
+type frameConn struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func newFrameConn(tb testing.TB) *frameConn {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		peer, err := ln.Accept()
+		if err == nil {
+			io.Copy(io.Discard, peer)
+			peer.Close()
+		}
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return &frameConn{conn: conn}
+}
+
+// basicAck 是一个 basic.ack 帧的大小：帧头 7 字节，方法 13 字节，帧尾 1 字节。
+var basicAck = make([]byte, 21)
+
+func (c *frameConn) send(frame []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// fakeAcker 代替一个 channel 的 ack，记录 ack 的次数和最后一次 ack 的 delivery tag。
+type fakeAcker struct {
+	conn  *frameConn // 为空时 ack 不写帧
+	acks  int64
+	acked int64 // 最后一次 ack 的 delivery tag
+}
+
+func (a *fakeAcker) Ack(tag uint64, multiple bool) error {
+	atomic.AddInt64(&a.acks, 1)
+	atomic.StoreInt64(&a.acked, int64(tag))
+	if a.conn == nil {
+		return nil
+	}
+	return a.conn.send(basicAck)
+}
+
+func (a *fakeAcker) Nack(tag uint64, multiple, requeue bool) error { return nil }
+func (a *fakeAcker) Reject(tag uint64, requeue bool) error         { return nil }
+
+func testDelivery(tb testing.TB, acker amqp.Acknowledger, tag uint64, authorizationID string) amqp.Delivery {
+	order := messages.OrderMessage{
+		SchemaVersion:   messages.SchemaVersion,
+		OrderID:         int(tag),
+		CartID:          1,
+		Items:           []messages.OrderItem{{ProductID: 1, Quantity: 1}},
+		CustomerID:      1,
+		AuthorizationID: authorizationID,
+		CorrelationID:   fmt.Sprintf("corr-%d", tag),
+		CreatedAt:       time.Now(),
+		Currency:        "USD",
+		Subtotal:        100,
+		Total:           100,
+		ShippingMethod:  "standard",
+	}
+	body, err := json.Marshal(order)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return amqp.Delivery{
+		Acknowledger: acker,
+		DeliveryTag:  tag,
+		Headers:      messages.Headers(),
+		Body:         body,
+	}
+}
+
+func testWorker(payments *paymentClient) (*worker, chan amqp.Delivery) {
+	msgs := make(chan amqp.Delivery, 64)
+	return &worker{
+		id:       1,
+		ch:       &fakeChannel{},
+		msgs:     msgs,
+		payments: payments,
+		stock:    newInventory(),
+	}, msgs
+}
+
+// TestCaptureAfterAck 确认整批先 ack 再 capture：CCA 慢的时候消息不会一直不 ack。
+func TestCaptureAfterAck(t *testing.T) {
+	acker := &fakeAcker{}
+	var ackedAtCapture []int64
+	var mu sync.Mutex
+	cca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ackedAtCapture = append(ackedAtCapture, atomic.LoadInt64(&acker.acked))
+		mu.Unlock()
+	}))
+	defer cca.Close()
+
+	w, msgs := testWorker(newPaymentClient(cca.URL+"/credit-card-authorizer/authorize", time.Second))
+	for tag := uint64(1); tag <= 3; tag++ {
+		msgs <- testDelivery(t, acker, tag, fmt.Sprintf("auth_%d", tag))
+	}
+	close(msgs)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	w.run(batchConfig{prefetch: 3, size: 3, interval: time.Minute}, context.Background(), &wg)
+
+	if acker.acks != 1 {
+		t.Errorf("got %d acks, want 1 for the batch", acker.acks)
+	}
+	if len(ackedAtCapture) != 3 {
+		t.Fatalf("got %d captures, want 3", len(ackedAtCapture))
+	}
+	for _, tag := range ackedAtCapture {
+		if tag != 3 {
+			t.Errorf("capture ran before the batch was acked (acked up to %d)", tag)
+		}
+	}
+}
+
+// TestVoidBackordered 确认缺货的订单不 capture，而是 void 授权，hold 不会一直占着额度。
+func TestVoidBackordered(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	cca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls = append(calls, r.URL.Path)
+		mu.Unlock()
+	}))
+	defer cca.Close()
+
+	w, msgs := testWorker(newPaymentClient(cca.URL+"/credit-card-authorizer/authorize", time.Second))
+	w.stock.onHand[1] = 2 // 只够前两个订单
+	for tag := uint64(1); tag <= 3; tag++ {
+		msgs <- testDelivery(t, &fakeAcker{}, tag, fmt.Sprintf("auth_%d", tag))
+	}
+	close(msgs)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	w.run(batchConfig{prefetch: 3, size: 3, interval: time.Minute}, context.Background(), &wg)
+
+	want := map[string]bool{
+		"/credit-card-authorizer/authorizations/auth_1/capture": true,
+		"/credit-card-authorizer/authorizations/auth_2/capture": true,
+		"/credit-card-authorizer/authorizations/auth_3/void":    true,
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("got CCA calls %v, want %d", calls, len(want))
+	}
+	for _, path := range calls {
+		if !want[path] {
+			t.Errorf("unexpected CCA call %s", path)
+		}
+	}
+}
+
+// TestVoidRetried 确认 CCA 暂时出错时 void 会重试，缺货订单的 hold 不会因为一次失败就留着；
+// 409 说明授权已经不是 authorized，不再重试。
+func TestVoidRetried(t *testing.T) {
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	cca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		calls[r.URL.Path]++
+		n := calls[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case strings.Contains(r.URL.Path, "auth_2"):
+			w.WriteHeader(http.StatusConflict)
+		case n < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer cca.Close()
+
+	payments := newPaymentClient(cca.URL+"/credit-card-authorizer/authorize", time.Second)
+	payments.retryDelay = time.Millisecond
+	w, msgs := testWorker(payments)
+	w.stock.onHand[1] = 0 // 全部缺货
+	for tag := uint64(1); tag <= 2; tag++ {
+		msgs <- testDelivery(t, &fakeAcker{}, tag, fmt.Sprintf("auth_%d", tag))
+	}
+	close(msgs)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	w.run(batchConfig{prefetch: 2, size: 2, interval: time.Minute}, context.Background(), &wg)
+
+	want := map[string]int{
+		"/credit-card-authorizer/authorizations/auth_1/void": 3,
+		"/credit-card-authorizer/authorizations/auth_2/void": 1,
+	}
+	for path, n := range want {
+		if calls[path] != n {
+			t.Errorf("%s called %d times, want %d", path, calls[path], n)
+		}
+	}
+}
+
+// TestCaptureTimeout 确认 capture 有单次调用的超时，CCA 挂住时 worker 不会跟着挂住。
+func TestCaptureTimeout(t *testing.T) {
+	release := make(chan struct{})
+	cca := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer cca.Close()
+	defer close(release)
+
+	payments := newPaymentClient(cca.URL, 50*time.Millisecond)
+	start := time.Now()
+	err := payments.capture(context.Background(), "auth_1")
+	if err == nil {
+		t.Fatal("capture against a hung CCA succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("capture took %s, want about 50ms", elapsed)
+	}
+}
+
+// benchWorkers 是基准测试里并发处理消息的 worker 数。
+const benchWorkers = 4
+
+// legacyOrder 和 legacyWorker 重现改动前的处理方式，只在基准测试里用来对比：
+// 所有 worker 共用一个 channel，每条消息都拿全局锁更新计数器，再单独 ack。
+type legacyOrder struct {
+	OrderID int `json:"order_id"`
+	CartID  int `json:"cart_id"`
+	Items   []struct {
+		ProductID int `json:"product_id"`
+		Quantity  int `json:"quantity"`
+	} `json:"items"`
+}
+
+var (
+	legacyMu     sync.Mutex
+	legacyTotal  int64
+	legacyCounts = make(map[int]int64)
+)
+
+func legacyWorker(msgs <-chan amqp.Delivery, wg *sync.WaitGroup) {
+	defer wg.Done()
+	for d := range msgs {
+		var order legacyOrder
+		if err := json.Unmarshal(d.Body, &order); err == nil {
+			legacyMu.Lock()
+			legacyTotal++
+			for _, item := range order.Items {
+				legacyCounts[item.ProductID] += int64(item.Quantity)
+			}
+			legacyMu.Unlock()
+		}
+		_ = d.Ack(false)
+	}
+}
+
+// benchBodies 生成 n 条不带 schema-version header 的 v1 订单消息，商品分散在 100 个 ID 上。
+func benchBodies(n int) [][]byte {
+	bodies := make([][]byte, n)
+	for i := range bodies {
+		bodies[i] = []byte(fmt.Sprintf(`{"order_id":%d,"cart_id":1,"items":[{"product_id":%d,"quantity":1}]}`, i+1, i%100+1))
+	}
+	return bodies
+}
+
+// BenchmarkThroughput 比较 benchWorkers 个 worker 每秒处理的消息数（msgs/s）：
+// legacy 是改动前的处理方式；pool/batch-N 是现在的 worker 池，每个 worker 独立的 channel，
+// 攒够 N 条后更新分片计数器，再用 multiple=true 一次 ack。
+// 加上 -cpu 1,4,16 可以看到全局锁在多核下的争用。
+func BenchmarkThroughput(b *testing.B) {
+	b.Run("legacy", func(b *testing.B) {
+		bodies := benchBodies(b.N)
+		acker := &fakeAcker{conn: newFrameConn(b)}
+		msgs := make(chan amqp.Delivery, 10) // 原来硬编码的 Qos(10)
+		var wg sync.WaitGroup
+		wg.Add(benchWorkers)
+		for i := 0; i < benchWorkers; i++ {
+			go legacyWorker(msgs, &wg)
+		}
+
+		b.ResetTimer()
+		for n, body := range bodies {
+			msgs <- amqp.Delivery{Acknowledger: acker, DeliveryTag: uint64(n + 1), Body: body}
+		}
+		close(msgs)
+		wg.Wait()
+		b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+		b.ReportMetric(float64(acker.acks)/float64(b.N), "acks/msg")
+	})
+
+	for _, size := range []int{10, 50} {
+		b.Run(fmt.Sprintf("pool/batch-%d", size), func(b *testing.B) {
+			bodies := benchBodies(b.N)
+			cfg := batchConfig{prefetch: size, size: size, interval: time.Minute}
+			feeds := make([]chan amqp.Delivery, benchWorkers)
+			ackers := make([]*fakeAcker, benchWorkers)
+			conn := newFrameConn(b) // worker 的 channel 都开在同一条连接上
+			var wg sync.WaitGroup
+			for i := range feeds {
+				feeds[i] = make(chan amqp.Delivery, cfg.prefetch)
+				ackers[i] = &fakeAcker{conn: conn}
+				w, _ := testWorker(nil)
+				w.id, w.msgs = i, feeds[i]
+				wg.Add(1)
+				go w.run(cfg, context.Background(), &wg)
+			}
+
+			b.ResetTimer()
+			// broker 把消息轮流推给各个 consumer
+			for n, body := range bodies {
+				i := n % benchWorkers
+				feeds[i] <- amqp.Delivery{Acknowledger: ackers[i], DeliveryTag: uint64(n + 1), Body: body}
+			}
+			for _, feed := range feeds {
+				close(feed)
+			}
+			wg.Wait()
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "msgs/s")
+			var acks int64
+			for _, a := range ackers {
+				acks += a.acks
+			}
+			b.ReportMetric(float64(acks)/float64(b.N), "acks/msg")
+		})
+	}
+}
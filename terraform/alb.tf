@@ -277,6 +277,48 @@ resource "aws_lb_listener_rule" "shopping_cart" {
   }
 }
 
+# Listener Rule for customer carts (GET /customers/{id}/cart) - served by Shopping Cart Service
+resource "aws_lb_listener_rule" "shopping_cart_customers" {
+  listener_arn = aws_lb_listener.http.arn
+  priority     = 210
+
+  action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.shopping_cart.arn
+  }
+
+  condition {
+    path_pattern {
+      values = ["/customers*"]
+    }
+  }
+
+  tags = {
+    Name = "shopping-cart-customers-rule"
+  }
+}
+
+# Listener Rule for order status (GET /orders/{id}, the async checkout status URL) - served by Shopping Cart Service
+resource "aws_lb_listener_rule" "shopping_cart_orders" {
+  listener_arn = aws_lb_listener.http.arn
+  priority     = 220
+
+  action {
+    type             = "forward"
+    target_group_arn = aws_lb_target_group.shopping_cart.arn
+  }
+
+  condition {
+    path_pattern {
+      values = ["/orders*"]
+    }
+  }
+
+  tags = {
+    Name = "shopping-cart-orders-rule"
+  }
+}
+
 # Listener Rule for Credit Card Authorizer Service - path-based routing
 resource "aws_lb_listener_rule" "cca" {
   listener_arn = aws_lb_listener.http.arn
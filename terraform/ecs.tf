@@ -160,6 +160,10 @@ resource "aws_ecs_task_definition" "shopping_cart" {
         {
           name  = "RABBITMQ_URI"
           value = var.rabbitmq_uri
+        },
+        {
+          name  = "PRODUCT_SERVICE_URL"
+          value = "http://${aws_lb.main.dns_name}"
         }
       ]
     }
@@ -132,6 +132,10 @@ resource "aws_ecs_task_definition" "warehouse" {
         {
           name  = "WAREHOUSE_WORKERS"
           value = tostring(var.warehouse_workers)   # NEW: worker 数量
+        },
+        {
+          name  = "CCA_URL"
+          value = "http://${aws_lb.main.dns_name}/credit-card-authorizer/authorize"   # 出库后 capture 授权
         }
       ]
 
@@ -104,9 +104,14 @@ variable "shopping_cart_service_desired_count" {
 }
 
 variable "cca_service_desired_count" {
-  description = "Desired count for credit card authorizer service"
+  description = "Desired count for credit card authorizer service (authorizations are kept in memory, so it must run as a single instance)"
   type        = number
   default     = 1
+
+  validation {
+    condition     = var.cca_service_desired_count == 1
+    error_message = "The credit card authorizer keeps authorizations in memory and must run as a single instance."
+  }
 }
 
 variable "rabbitmq_service_desired_count" {